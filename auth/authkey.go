@@ -2,21 +2,39 @@ package auth
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// ErrNoUsers reports an AuthKey store without any user besides the admin;
+// see Healthy
+var ErrNoUsers = errors.New("authkey: no users loaded")
+
+// ErrNotSaved reports a keys file that failed to load or had malformed
+// lines skipped, which save refuses to overwrite so that no user is lost
+var ErrNotSaved = errors.New("authkey: keys file not overwritten")
+
 // AuthKey structure for authentication and credential management for
 // authorized user acces to restricted content.
 //
@@ -24,13 +42,43 @@ import (
 // however the admin management routes require a header token:{apikey}
 // value be set to access the user management routes.
 type AuthKey struct {
-	path   *string           // user:key map file location; memory only when nil
-	uMap   map[string]string // apikey->user map
-	mwUser struct{}          // middleware transport chain key
-	mu     sync.Mutex        // mutex for uMap concurrency protection
-	silent bool              // silent output after bootstrap ends
-	admin  string            // admin user name; admin
-	hKey   string            // header key name; token
+	path     *string                       // user:key map file location; memory only when nil
+	uMap     map[string]string             // apikey->user map
+	off      map[string]bool               // disabled users
+	cidr     map[string][]netip.Prefix     // user source address allowlist
+	mwUser   struct{}                      // middleware transport chain key
+	mu       sync.Mutex                    // mutex for uMap concurrency protection
+	silent   bool                          // silent output after bootstrap ends
+	noAuto   bool                          // no automatic admin creation
+	gzip     bool                          // gzip compressed keys file
+	every    time.Duration                 // Start refresh interval
+	cased    bool                          // case-sensitive users and keys
+	query    bool                          // ?{hKey}= query token fallback
+	lock     *lockout                      // failed attempt lockout; nil off
+	auditW   io.Writer                     // admin mutation audit log
+	adminKey string                        // bootstrap admin key file
+	rand     io.Reader                     // key entropy; crypto/rand when nil
+	size     int                           // generated key bytes; 8 when zero
+	stop     chan struct{}                 // closed by Close
+	format   string                        // keys file write format; detected when empty
+	detected string                        // keys file format found on load
+	header   []string                      // csv/tsv columns
+	noHeader bool                          // csv/tsv file without a header row
+	extra    map[string]map[string]string  // csv/tsv columns preserved per user
+	notes    map[string][]string           // text # comments ahead of each user
+	loadErr  error                         // last refresh read error
+	skipped  int                           // malformed lines skipped by the last refresh
+	grace    map[string]graceKey           // rotated apikey->user until expiry
+	closing  sync.Once                     // Close once
+	delay    time.Duration                 // coalesced save window; 0 saves each mutation
+	pending  *time.Timer                   // scheduled coalesced save
+	dirty    bool                          // local changes not yet saved
+	saveMu   sync.Mutex                    // keys file write serialization
+	auditMu  sync.Mutex                    // audit log write serialization
+	onChange func(event, user, key string) // user mutation hook
+	admin    string                        // admin user name; admin
+	hKey     string                        // header key name; token
+	onAuth   func(string, *http.Request)   // successful authentication hook
 }
 
 // NewAuthKey configurator will initialize an *auth.Auth and populate the
@@ -42,28 +90,84 @@ func NewAuthKey(path *string, r *chi.Mux) *AuthKey {
 		r = chi.NewMux()
 	}
 
-	ak := new(AuthKey).Configure(path)
+	return new(AuthKey).Configure(path).Routes(r)
+}
+
+// Routes configures the admin management routes on a chi.Router; used
+// directly when options must be set before Configure is called
+//
+//	ak := new(auth.AuthKey).NoAutoAdmin().Configure(&path).Routes(router)
+func (a *AuthKey) Routes(r chi.Router) *AuthKey {
+
 	r.Route("/a", func(rx chi.Router) {
-		rx.Use(ak.IsAdmin)
-		rx.Get("/", ak.UserHandler())
-		rx.Get("/users", ak.UserHandler())
-		rx.Get("/add/{user}", ak.AddHandler())
-		rx.Get("/remove/{user}", ak.DeleteHandler())
-		rx.Get("/update/{user}", ak.UpdateHandler())
-		rx.Get("/refresh", ak.RefreshHandler())
+		rx.Use(a.IsAdmin)
+		rx.Get("/", a.UserHandler())
+		rx.Get("/users", a.UserHandler())
+		rx.Get("/names", a.NamesHandler())
+		rx.Get("/add/{user}", a.AddHandler())
+		rx.Post("/add", a.BatchHandler())
+		rx.Get("/remove/{user}", a.DeleteHandler())
+		rx.Get("/update/{user}", a.UpdateHandler())
+		rx.Get("/rotate/{user}", a.RotateHandler())
+		rx.Get("/disable/{user}", a.DisableHandler())
+		rx.Get("/enable/{user}", a.EnableHandler())
+		rx.Get("/refresh", a.RefreshHandler())
 	})
 
-	return ak
+	return a
 }
 
 // generateKey defines the key generation methodology
 // used for ApiKey generation; eg. 5aee4f739eb44c2c
 func (a *AuthKey) generateKey() string {
 
-	var b [8]byte
-	rand.Read(b[:])
+	src := a.rand
+	if src == nil {
+		src = rand.Reader
+	}
+
+	n := a.size
+	if n == 0 {
+		n = 8
+	}
+
+	// a short or failing source would repeat the same key forever so
+	// uniqueKey could never find a free one; crypto/rand takes over
+	b := make([]byte, n)
+	if _, err := io.ReadFull(src, b); err != nil {
+		log.Println("alert: auth: key entropy", err)
+		if _, err = io.ReadFull(rand.Reader, b); err != nil {
+			panic("auth: key entropy: " + err.Error())
+		}
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// KeyBytes sets the random byte count of newly generated keys, which are
+// hex encoded at twice the length; existing keys of any length continue to
+// validate and n is held to 8..64 bytes {default:8}
+//
+//	ak := new(auth.AuthKey).KeyBytes(16).Configure(&path) // 128-bit keys
+func (a *AuthKey) KeyBytes(n int) *AuthKey {
+	switch {
+	case n < 8:
+		n = 8
+	case n > 64:
+		n = 64
+	}
+	a.size = n
+	return a
+}
 
-	return fmt.Sprintf("%016x", b[:])
+// uniqueKey generates keys until one is not already assigned so that
+// a collision can never silently reassign a user; caller holds the lock
+func (a *AuthKey) uniqueKey() string {
+	for {
+		if key := a.generateKey(); len(a.uMap[key]) == 0 {
+			return key
+		}
+	}
 }
 
 // Silent toggle; {default:on}
@@ -72,41 +176,277 @@ func (a *AuthKey) Silent() *AuthKey { a.silent = !a.silent; return a }
 // Admin sets the admin name; {default:admin}
 func (a *AuthKey) Admin(name string) *AuthKey { a.admin = name; return a }
 
+// NoAutoAdmin toggle disables creating an admin user when Configure
+// loads an empty store; must be set before Configure {default:off}
+func (a *AuthKey) NoAutoAdmin() *AuthKey { a.noAuto = !a.noAuto; return a }
+
+// Gzip toggle stores the keys file gzip compressed; implied when the
+// path has a .gz extension while loading detects a compressed file by
+// its content either way {default:off}
+func (a *AuthKey) Gzip() *AuthKey { a.gzip = !a.gzip; return a }
+
 // HKey sets the header key name; {default:token}
 func (a *AuthKey) HKey(key string) *AuthKey { a.hKey = key; return a }
 
+// OnAuthSuccess sets a hook invoked by IsValid after each successful
+// authentication with the resolved user; runs outside any held lock
+func (a *AuthKey) OnAuthSuccess(fn func(user string, r *http.Request)) *AuthKey {
+	a.onAuth = fn
+	return a
+}
+
+// QueryToken toggles the IsValid ?{hKey}={apikey} query string fallback for
+// webhook providers that can only configure a url; a query token is
+// recorded in access logs, proxy logs, and browser history so only use it
+// with keys dedicated to that integration {default:off}
+//
+//	https://example.com/hook?token={apikey}
+func (a *AuthKey) QueryToken() *AuthKey { a.query = !a.query; return a }
+
+// Lockout enables a brute-force lockout where n failed keys from a source
+// address within window get 429 responses for cooldown; a successful
+// authentication resets the address and n < 1 disables it {default:off}
+//
+//	ak.Lockout(5, time.Minute, time.Minute*15)
+func (a *AuthKey) Lockout(n int, window, cooldown time.Duration) *AuthKey {
+	a.lock = newLockout(n, window, cooldown)
+	return a
+}
+
+// AdminKeyFile sets a file that receives the admin key when Configure
+// creates the admin on first boot so that recovery does not depend on
+// the log, which Silent suppresses; must be set before Configure
+//
+//	ak := new(auth.AuthKey).Silent().AdminKeyFile("/run/secrets/admin.key").Configure(&path)
+func (a *AuthKey) AdminKeyFile(path string) *AuthKey { a.adminKey = path; return a }
+
+// writeAdminKey atomically writes the bootstrap admin key to the
+// AdminKeyFile using a temp file and rename; the file is owner only
+func (a *AuthKey) writeAdminKey(key string) {
+
+	if len(a.adminKey) == 0 {
+		return
+	}
+
+	if err := writeFileAtomic(a.adminKey, []byte(key+"\n"), 0600); err != nil {
+		log.Println("auth: admin key file", err)
+	}
+
+}
+
+// Audit sets an append-only audit log that receives a json line for
+// every successful admin mutation with the time, acting admin, remote
+// address, action, and target user; keys are never written {default:off}
+//
+//	f, _ := os.OpenFile("/var/log/authkey.audit", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+//	ak.Audit(f)
+func (a *AuthKey) Audit(w io.Writer) *AuthKey { a.auditW = w; return a }
+
+// audit appends an admin mutation entry to the audit log
+func (a *AuthKey) audit(r *http.Request, action, user string) {
+
+	if a.auditW == nil {
+		return
+	}
+
+	admin, _ := r.Context().Value(a.mwUser).(string)
+	b, _ := json.Marshal(struct {
+		Time   string `json:"time"`
+		Admin  string `json:"admin"`
+		Remote string `json:"remote"`
+		Action string `json:"action"`
+		User   string `json:"user,omitempty"`
+	}{time.Now().UTC().Format(time.RFC3339), admin, r.RemoteAddr, action, user})
+
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+	if _, err := a.auditW.Write(append(b, '\n')); err != nil {
+		log.Println("auth: audit", err)
+	}
+}
+
+// CaseSensitive toggle preserves the case of user names and keys for
+// storage and lookup; eg. legacy mixed-case base64 keys, must be set
+// before Configure loads the keys file {default:off}
+func (a *AuthKey) CaseSensitive() *AuthKey { a.cased = !a.cased; return a }
+
+// fold applies the case policy to a user name or key
+func (a *AuthKey) fold(s string) string {
+	if a.cased {
+		return s
+	}
+	return strings.ToLower(s)
+}
+
+// OnChange sets a hook invoked after a user mutation is saved with the
+// event [add|delete|update|rotate|disable|enable|allow], the user, and
+// the key when relevant; eg. to sync downstream billing or directory systems
+func (a *AuthKey) OnChange(fn func(event, user, key string)) *AuthKey {
+	a.onChange = fn
+	return a
+}
+
 // User will set a manual user,key combination; key must 6 or more characters
+// and neither may contain whitespace, commas, or control characters
 func (a *AuthKey) User(user, key string) *AuthKey {
-	if len(user) > 0 && len(key) > 5 {
+	if validField(user) && len(key) > 5 && validField(key) {
 		a.mu.Lock()
-		a.uMap[strings.ToLower(key)] = strings.ToLower(user)
+		a.uMap[a.fold(key)] = a.fold(user)
 		a.mu.Unlock()
 	}
 	return a
 }
 
+// Allow restricts user to source addresses within the CIDR allowlist, a
+// bare IP is a single address, and no cidr removes the restriction; a
+// valid key presented from elsewhere is rejected with 403 by the
+// middleware and the list is stored in the keys file as a comma list
+//
+//	ak.Allow("deploy", "10.0.0.0/8", "192.0.2.7")
+func (a *AuthKey) Allow(user string, cidr ...string) *AuthKey {
+
+	list, err := parseCIDR(strings.Join(cidr, ","))
+	if err != nil {
+		log.Println("auth: allow", err)
+		return a
+	}
+
+	user = a.fold(user)
+	a.mu.Lock()
+	if len(list) == 0 {
+		delete(a.cidr, user)
+	} else {
+		a.cidr[user] = list
+	}
+	a.mu.Unlock()
+	a.changed(a.persist(), "allow", user, "")
+
+	return a
+}
+
+// parseCIDR parses a comma separated CIDR list where a bare IP is
+// a single address prefix
+func parseCIDR(s string) (list []netip.Prefix, err error) {
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); len(c) == 0 {
+			continue
+		}
+		var p netip.Prefix
+		if addr, aerr := netip.ParseAddr(c); aerr == nil {
+			p = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		} else if p, err = netip.ParsePrefix(c); err != nil {
+			return nil, err
+		}
+		list = append(list, p.Masked())
+	}
+	return
+}
+
+// Refresh sets the Start reload interval from disk; {default:1h}
+func (a *AuthKey) Refresh(d time.Duration) *AuthKey { a.every = d; return a }
+
 // Start automated authorization refreshing; useful on clusters which
-// share a common file or sync'd file system
-func (a *AuthKey) Start(ctx context.Context, refresh *time.Duration) {
+// share a common file or sync'd file system and satisfies the env
+// graceful manager Start(ctx) signature
+//
+//	grace.Manager(ak.Refresh(time.Minute * 5))
+func (a *AuthKey) Start(ctx context.Context) {
 
-	if refresh == nil || *refresh == 0 {
-		freq := time.Hour
-		*refresh = freq
+	freq := time.Hour
+	if a.every > 0 {
+		freq = a.every
 	}
 
-	tick := time.NewTicker(*refresh)
+	stop := a.stopped()
+	tick := time.NewTicker(freq)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-tick.C:
+			a.refresh()
+		}
+	}
+}
 
-	select {
-	case <-ctx.Done():
-		tick.Stop()
-		return
-	case <-tick.C:
-		a.refresh()
+// Close stops the Start refresh and performs a final save when there are
+// unsaved local changes so that last minute changes are not lost on exit;
+// neither Start nor Close saves otherwise since a cluster sharing the keys
+// file could be overwritten
+//
+//	defer ak.Close()
+func (a *AuthKey) Close() error {
+	a.closing.Do(func() { close(a.stopped()) })
+	a.mu.Lock()
+	dirty := a.dirty
+	a.mu.Unlock()
+	if !dirty {
+		return nil
 	}
+	return a.Flush()
+}
+
+// SaveDelay coalesces the keys file writes of rapid mutations into one
+// save at most d after the first unsaved change instead of a full rewrite
+// per mutation; OnChange then fires before the write and Close, Flush, or
+// a refresh write any pending change {default:0 save each mutation}
+func (a *AuthKey) SaveDelay(d time.Duration) *AuthKey { a.delay = d; return a }
+
+// Flush writes the keys file now, cancelling any pending SaveDelay save;
+// eg. for tests or before a critical read of the file
+func (a *AuthKey) Flush() error {
+	a.mu.Lock()
+	if a.pending != nil {
+		a.pending.Stop()
+		a.pending = nil
+	}
+	a.mu.Unlock()
+	return a.save()
+}
+
+// persist saves after a mutation, or with SaveDelay schedules a single
+// save for all the mutations within the delay window; the error reports a
+// change that is in effect but not saved and is lost on restart
+func (a *AuthKey) persist() error {
+
+	a.mu.Lock()
+	a.dirty = true
+	a.mu.Unlock()
+
+	if a.delay <= 0 || a.path == nil {
+		return a.save()
+	}
+
+	if err := a.unsafe(); err != nil { // the delayed save would fail
+		return err
+	}
+
+	a.mu.Lock()
+	if a.pending == nil {
+		a.pending = time.AfterFunc(a.delay, func() { a.Flush() })
+	}
+	a.mu.Unlock()
+	return nil
+}
+
+// stopped lazily creates the Close signal channel
+func (a *AuthKey) stopped() chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stop == nil {
+		a.stop = make(chan struct{})
+	}
+	return a.stop
 }
 
 // Configure will populate uMap from disk and create a default
-// admin user when no current file exists (or path is file)
+// admin user when the store has no users (no file, an empty file, or
+// path is nil) unless NoAutoAdmin is set, leaving the store empty for
+// explicit seeding; a file that failed to load or had malformed lines
+// skipped is never replaced by an admin
 func (a *AuthKey) Configure(path *string) *AuthKey {
 
 	// set path default
@@ -124,33 +464,77 @@ func (a *AuthKey) Configure(path *string) *AuthKey {
 		a.HKey("token")
 	}
 
-	if a.refresh() == 0 {
-		if key := a.add(a.admin); !a.silent {
+	n := a.refresh()
+	a.mu.Lock()
+	clean := a.loadErr == nil && a.skipped == 0
+	a.mu.Unlock()
+
+	switch {
+	case n > 0 || a.noAuto:
+	case clean:
+		key, _ := a.add(a.admin) // save reports its own failure
+		if !a.silent {
 			log.Printf("auth: add %s [%s]", a.admin, key)
 		}
+		a.writeAdminKey(key)
+	default:
+		log.Printf("alert: auth: load @%s failed; admin not created", *a.path)
 	}
 
 	return a
 }
 
-// refresh builds uMap from disk; user apikey
+// refresh builds uMap from disk in the detected text, csv, or tsv format
 func (a *AuthKey) refresh() (n int) {
 
+	// write pending SaveDelay changes rather than discard them
+	a.mu.Lock()
+	pending := a.pending != nil
+	a.mu.Unlock()
+	if pending {
+		a.Flush()
+	}
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	a.uMap = make(map[string]string)
-
+	a.off = make(map[string]bool)
+	a.cidr = make(map[string][]netip.Prefix)
+	a.extra = make(map[string]map[string]string)
+	a.notes = make(map[string][]string)
+	a.header, a.noHeader = nil, false
+	a.dirty = false // unsaved changes are replaced by the file
+
+	a.loadErr, a.skipped = nil, 0
 	if a.path != nil {
 		f, err := os.Open(*a.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			a.loadErr = err // a missing file is a store without users
+		}
 		if err == nil {
 
-			scanner := bufio.NewScanner(f)
-			for scanner.Scan() {
-				var user, key string
-				fmt.Sscanf(scanner.Text(), "%s %s", &user, &key)
-				a.uMap[key] = user
-				n++
+			// gzip is detected from the magic bytes rather than trusted
+			// from the setting so that toggling Gzip over a plain file
+			// still loads it and the next save converts it
+			br := bufio.NewReader(f)
+			if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+				zr, err := gzip.NewReader(br)
+				if err != nil {
+					log.Printf("auth: load @%s %v", *a.path, err)
+					a.loadErr = err
+					f.Close()
+					return
+				}
+				defer zr.Close()
+				br = bufio.NewReader(zr)
+			}
+
+			a.detected = sniff(br)
+			if a.detected == formatText {
+				n = a.loadText(br)
+			} else {
+				n = a.loadCSV(br, a.detected)
 			}
 			f.Close()
 		}
@@ -159,69 +543,410 @@ func (a *AuthKey) refresh() (n int) {
 	if len(a.uMap) > 0 && !a.silent {
 		log.Printf("auth: load @%s [%d]", *a.path, n)
 	}
+	if a.skipped > 0 {
+		log.Printf("alert: auth: load @%s %d malformed lines skipped; keys file will not be overwritten", *a.path, a.skipped)
+	}
 
 	return
 }
 
-// save uMap to disk; user apikey
-func (a *AuthKey) save() {
+// Healthy reports whether the last refresh read the keys file without
+// malformed lines and the store holds a user besides the admin, catching a
+// missing, unreadable, or empty keys file that would leave only the
+// auto-admin; eg. for readiness
+//
+//	router := server.Public(server.Heartbeat, nil, nil,
+//		server.WithReadyz(func() bool { return ak.Healthy() == nil }))
+func (a *AuthKey) Healthy() error {
 
-	if a.path != nil {
-		f, err := os.Create(*a.path)
-		if err == nil {
-			a.mu.Lock()
-			for k := range a.uMap {
-				fmt.Fprintln(f, a.uMap[k], k)
-			}
-			a.mu.Unlock()
-			f.Close()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.loadErr != nil {
+		return fmt.Errorf("authkey: load: %w", a.loadErr)
+	}
+	if a.skipped > 0 {
+		return fmt.Errorf("authkey: load: %d malformed lines skipped", a.skipped)
+	}
+	for _, user := range a.uMap {
+		if user != a.admin {
+			return nil
 		}
 	}
+	return ErrNoUsers
+}
+
+// compressed reports when the keys file is stored gzip compressed
+func (a *AuthKey) compressed() bool {
+	return a.gzip || (a.path != nil && strings.HasSuffix(*a.path, ".gz"))
+}
+
+// save uMap to disk in the Format selection or the detected format
+//
+// the file is written to a temp file with owner only permissions
+// and renamed into place so readers never observe a partial file; a
+// keys file that failed to load or had malformed lines is not replaced
+// until it is fixed and reloaded
+func (a *AuthKey) save() error {
+
+	if a.path == nil {
+		return nil
+	}
+
+	a.saveMu.Lock() // an older snapshot must not replace a newer one
+	defer a.saveMu.Unlock()
+
+	if err := a.unsafe(); err != nil {
+		log.Println("alert: auth: save", err)
+		return err
+	}
+
+	var err error
+	var buf bytes.Buffer
+	var zw *gzip.Writer
+	var w io.Writer = &buf
+	if a.compressed() {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	a.mu.Lock()
+	if format := a.writeFormat(); format == formatText {
+		a.writeText(w)
+	} else {
+		err = a.writeCSV(w, format)
+	}
+	a.dirty = false // this snapshot holds every change so far
+	a.mu.Unlock()
+
+	if zw != nil && err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = writeFileAtomic(*a.path, buf.Bytes(), 0600)
+	}
+	if err != nil {
+		log.Println("auth: save", err)
+		a.mu.Lock()
+		a.dirty = true
+		a.mu.Unlock()
+	}
+
+	return err
+}
+
+// unsafe reports why the loaded keys file must not be overwritten
+func (a *AuthKey) unsafe() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case a.loadErr != nil:
+		return fmt.Errorf("%w; load: %v", ErrNotSaved, a.loadErr)
+	case a.skipped > 0:
+		return fmt.Errorf("%w; %d malformed lines skipped", ErrNotSaved, a.skipped)
+	}
+	return nil
+}
 
+// changed invokes the OnChange hook after a successful save
+func (a *AuthKey) changed(err error, event, user, key string) {
+	if err == nil && a.onChange != nil {
+		a.onChange(event, user, key)
+	}
 }
 
-// add user to uMap
-func (a *AuthKey) add(user string) string {
+// add user to uMap; the error is a failed save
+func (a *AuthKey) add(user string) (string, error) {
 
-	user = strings.ToLower(user)
-	key := a.generateKey()
+	user = a.fold(user)
 
 	a.mu.Lock()
+	key := a.uniqueKey()
 	a.uMap[key] = user
 	a.mu.Unlock()
-	a.save()
+	err := a.persist()
+	a.changed(err, "add", user, key)
+
+	return key, err
+}
 
-	return key
+// batchEntry is the outcome of one user in a bulk add
+type batchEntry struct {
+	User    string `json:"user"`
+	Key     string `json:"key,omitempty"`
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"`
 }
 
-// delete user from uMap
-func (a *AuthKey) delete(user string) bool {
+// addBatch adds each new user with a generated key under a single lock
+// and a single save; an invalid, existing, or repeated name is reported
+// in its entry without stopping the batch and the error is a failed save
+func (a *AuthKey) addBatch(users []string) ([]batchEntry, int, error) {
 
-	user = strings.ToLower(user)
-	if user != a.admin {
-		a.mu.Lock()
-		var k string
-		for k = range a.uMap {
-			if a.uMap[k] == user {
-				delete(a.uMap, k)
-				a.mu.Unlock()
-				a.save()
-				return true
+	entries := make([]batchEntry, len(users))
+	var added int
+
+	a.mu.Lock()
+	exists := make(map[string]bool, len(a.uMap)+len(users))
+	for _, user := range a.uMap {
+		exists[user] = true
+	}
+	for i := range users {
+		user := a.fold(strings.TrimSpace(users[i]))
+		entries[i].User = user
+		switch {
+		case !validField(user):
+			entries[i].Status, entries[i].Message = http.StatusBadRequest, "invalid user name"
+		case exists[user]:
+			entries[i].Status, entries[i].Message = http.StatusConflict, "user already exists"
+		default:
+			exists[user] = true
+			entries[i].Key = a.uniqueKey()
+			entries[i].Status = http.StatusCreated
+			a.uMap[entries[i].Key] = user
+			added++
+		}
+	}
+	a.mu.Unlock()
+
+	var err error
+	if added > 0 {
+		err = a.persist()
+		for i := range entries {
+			if entries[i].Status == http.StatusCreated {
+				a.changed(err, "add", entries[i].User, entries[i].Key)
 			}
 		}
+	}
+
+	return entries, added, err
+}
+
+// addKey errors
+var (
+	errUserExists  = errors.New("user already exists")
+	errKeyAssigned = errors.New("key already assigned")
+)
+
+// addKey adds a new user to uMap with a specific key, or a generated key
+// when key is empty; an existing user or an assigned key is an error and
+// otherwise the error is a failed save of the added user
+func (a *AuthKey) addKey(user, key string) (string, error) {
+
+	user, key = a.fold(user), a.fold(key)
+
+	a.mu.Lock()
+	for k := range a.uMap {
+		if a.uMap[k] == user {
+			a.mu.Unlock()
+			return "", errUserExists
+		}
+	}
+	if len(key) == 0 {
+		key = a.uniqueKey()
+	} else if _, ok := a.uMap[key]; ok {
 		a.mu.Unlock()
+		return "", errKeyAssigned
 	}
-	return false
+	a.uMap[key] = user
+	a.mu.Unlock()
+	err := a.persist()
+	a.changed(err, "add", user, key)
+
+	return key, err
+}
+
+// validField reports a user name or key that is safe to store in any keys
+// file format; whitespace, commas, and control characters would split or
+// add records and a leading # would be read back as a comment
+func validField(s string) bool {
+	if len(s) == 0 || s[0] == '#' {
+		return false
+	}
+	for _, c := range s {
+		if c == ',' || unicode.IsSpace(c) || unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// delete user and every key assigned to the user from uMap; the error
+// is a failed save
+func (a *AuthKey) delete(user string) (bool, error) {
+
+	user = a.fold(user)
+	if user == a.admin {
+		return false, nil
+	}
+
+	var keys []string
+	a.mu.Lock()
+	for k := range a.uMap {
+		if a.uMap[k] == user {
+			delete(a.uMap, k)
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) > 0 {
+		delete(a.off, user)
+		delete(a.cidr, user)
+		delete(a.extra, user)
+		delete(a.notes, user)
+		for g := range a.grace {
+			if a.grace[g].user == user {
+				delete(a.grace, g)
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	if len(keys) == 0 {
+		return false, nil
+	}
+	sort.Strings(keys)
+	err := a.persist()
+	for _, k := range keys {
+		a.changed(err, "delete", user, k)
+	}
+	return true, err
+}
+
+// update a user apikey in uMap; preserves the disabled state and the
+// error is a failed save
+func (a *AuthKey) update(user string) (string, bool, error) {
+
+	user = a.fold(user)
+	if user == a.admin {
+		return "", false, nil
+	}
+
+	a.mu.Lock()
+	key := a.uniqueKey()
+	var found bool
+	for k := range a.uMap {
+		if a.uMap[k] == user {
+			delete(a.uMap, k)
+			found = true
+			break
+		}
+	}
+	if found {
+		a.uMap[key] = user
+	}
+	a.mu.Unlock()
+
+	if !found {
+		return "", false, nil
+	}
+	err := a.persist()
+	a.changed(err, "update", user, key)
+
+	return key, true, err
+}
+
+// graceKey is a rotated key that remains valid until the grace expires
+type graceKey struct {
+	user  string
+	until time.Time
+}
+
+// rotate replaces the user apikey like update while the old key remains
+// valid in memory for the grace period; the keys file holds only the new
+// key so a restart or a delete ends the grace early; err is a failed save
+func (a *AuthKey) rotate(user string, grace time.Duration) (old, key string, until time.Time, ok bool, err error) {
+
+	user = a.fold(user)
+	if user == a.admin {
+		return
+	}
+
+	a.mu.Lock()
+	for k := range a.uMap {
+		if a.uMap[k] == user {
+			old, ok = k, true
+			break
+		}
+	}
+	if ok {
+		if a.grace == nil {
+			a.grace = make(map[string]graceKey)
+		}
+		key, until = a.uniqueKey(), time.Now().Add(grace)
+		delete(a.uMap, old)
+		a.uMap[key] = user
+		a.grace[old] = graceKey{user, until}
+	}
+	a.mu.Unlock()
+
+	if ok {
+		err = a.persist()
+		a.changed(err, "rotate", user, key)
+	}
+
+	return
+}
+
+// disable or enable a user in uMap without changing the apikey; the
+// admin can not be disabled, unknown users report false, and the error
+// is a failed save
+func (a *AuthKey) disable(user string, off bool) (bool, error) {
+
+	user = a.fold(user)
+	if user == a.admin {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	var found bool
+	for k := range a.uMap {
+		if a.uMap[k] == user {
+			found = true
+			break
+		}
+	}
+	if found {
+		if off {
+			a.off[user] = true
+		} else {
+			delete(a.off, user)
+		}
+	}
+	a.mu.Unlock()
+
+	var err error
+	if found {
+		event := "enable"
+		if off {
+			event = "disable"
+		}
+		err = a.persist()
+		a.changed(err, event, user, "")
+	}
+
+	return found, err
 }
 
-// update a user apikey in uMap
-func (a *AuthKey) update(user string) (string, bool) {
+// keys lists the apikeys assigned to user
+func (a *AuthKey) keys(user string) (keys []string) {
 
-	if a.delete(user) {
-		return a.add(user), true
+	user = a.fold(user)
+	a.mu.Lock()
+	for k := range a.uMap {
+		if a.uMap[k] == user {
+			keys = append(keys, k)
+		}
 	}
+	a.mu.Unlock()
+	sort.Strings(keys)
+
+	return
+}
 
-	return "", false
+// dryRun reports a ?dryrun=true admin request
+func dryRun(r *http.Request) bool {
+	ok, _ := strconv.ParseBool(r.URL.Query().Get("dryrun"))
+	return ok
 }
 
 // check the key in the uMap and returns the user and lookup status
@@ -229,7 +954,7 @@ func (a *AuthKey) check(key string) (user string, ok bool) {
 
 	if len(key) > 0 {
 		a.mu.Lock()
-		user, ok = a.uMap[key]
+		user, ok = a.lookup(key)
 		a.mu.Unlock()
 	}
 
@@ -237,86 +962,404 @@ func (a *AuthKey) check(key string) (user string, ok bool) {
 
 }
 
+// lookup the enabled user of key, including a rotated key within its
+// grace period; the caller holds the lock
+func (a *AuthKey) lookup(key string) (user string, ok bool) {
+	user, ok = a.uMap[a.fold(key)]
+	if g, found := a.grace[a.fold(key)]; !ok && found {
+		if user, ok = g.user, time.Now().Before(g.until); !ok {
+			delete(a.grace, a.fold(key)) // expired
+		}
+	}
+	if ok && a.off[user] {
+		user, ok = "", false
+	}
+	return user, ok
+}
+
+// checkCtx is check that gives up waiting for the lock when ctx is done
+// so a cancelled or timed out request does not pile up behind a long
+// admin operation; the lookup still completes in the background
+func (a *AuthKey) checkCtx(ctx context.Context, key string) (user string, ok bool) {
+
+	if len(key) == 0 {
+		return
+	}
+
+	if a.mu.TryLock() { // uncontended
+		defer a.mu.Unlock()
+		return a.lookup(key)
+	}
+
+	type result struct {
+		user string
+		ok   bool
+	}
+	ch := make(chan result, 1)
+	go func() {
+		user, ok := a.check(key)
+		ch <- result{user, ok}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.user, res.ok
+	case <-ctx.Done():
+		return "", false
+	}
+
+}
+
+// abandoned responds 503 when the request context ended while waiting
+// in checkCtx; this is not an authentication failure so no lockout
+// strike is recorded
+func abandoned(w http.ResponseWriter, r *http.Request) bool {
+	if r.Context().Err() == nil {
+		return false
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	return true
+}
+
+// permit reports when the request source address is within the user
+// CIDR allowlist; users without an allowlist are permitted from anywhere
+func (a *AuthKey) permit(user string, r *http.Request) bool {
+
+	a.mu.Lock()
+	list := a.cidr[user]
+	a.mu.Unlock()
+	if len(list) == 0 {
+		return true
+	}
+
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for i := range list {
+		if list[i].Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 //
 // HANDLERS
 //
 
-// AddHandler will add a new user to the ApiKey.uMap authority
+// AddHandler will add a new user to the ApiKey.uMap authority with a
+// generated key or a desired key of 6 or more characters that must not
+// already be assigned; eg. to preserve keys during a migration, while an
+// existing user is a 409 and a name or key with whitespace, commas, or
+// control characters is a 400
 //
 // .../add/{user}
+// .../add/{user}?key={desired}
 func (a *AuthKey) AddHandler() http.HandlerFunc {
 
 	type response struct {
-		Status int    `json:"status"`
-		User   string `json:"user,omitempty"`
-		Key    string `json:"key,omitempty"`
+		Status  int    `json:"status"`
+		Message string `json:"message,omitempty"`
+		User    string `json:"user,omitempty"`
+		Key     string `json:"key,omitempty"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var resp response
+		var err error
 		resp.User = chi.URLParam(r, "user")
-		resp.Key = a.add(resp.User)
+
+		desired := r.URL.Query().Get("key")
+		switch {
+		case !validField(resp.User):
+			resp.Status, resp.Message = http.StatusBadRequest, "invalid user name"
+		case len(desired) > 0 && len(desired) < 6:
+			resp.Status, resp.Message = http.StatusBadRequest, "key requires 6 or more characters"
+		case len(desired) > 0 && !validField(desired):
+			resp.Status, resp.Message = http.StatusBadRequest, "invalid key"
+		default:
+			resp.Key, err = a.addKey(resp.User, desired)
+			if errors.Is(err, errUserExists) || errors.Is(err, errKeyAssigned) {
+				resp.Status, resp.Message = http.StatusConflict, err.Error()
+			}
+		}
+		if resp.Status != 0 {
+			resp.Key = ""
+			reply(w, resp.Status, resp)
+			return
+		}
+
 		if !a.silent {
 			log.Printf("auth: add %s [%s]", resp.User, resp.Key)
 		}
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(resp)
+		a.audit(r, "add", a.fold(resp.User))
+		resp.Status = http.StatusCreated
+		if err != nil {
+			resp.Status, resp.Message = notSaved(err)
+		}
+		reply(w, resp.Status, resp)
 
 	}
 
 }
 
-// DeleteHandler removes a user from the ApiKey.uMap authority
+// BatchHandler adds the users in a POST json array of names with a
+// generated key each and a single save, reporting each entry on its own
+// so an invalid (400) or existing (409) name does not abort the batch
+//
+// .../add  ["bob","carol"]
+func (a *AuthKey) BatchHandler() http.HandlerFunc {
+
+	type response struct {
+		Status  int          `json:"status"`
+		Message string       `json:"message,omitempty"`
+		Added   int          `json:"added"`
+		Users   []batchEntry `json:"users,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var users []string
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<20)).Decode(&users); err != nil {
+			reply(w, http.StatusBadRequest, response{Status: http.StatusBadRequest, Message: "json array of user names required"})
+			return
+		}
+
+		entries, added, err := a.addBatch(users)
+		if !a.silent {
+			log.Printf("auth: add batch [%d/%d]", added, len(entries))
+		}
+		for i := range entries {
+			if entries[i].Status == http.StatusCreated {
+				a.audit(r, "add", entries[i].User)
+			}
+		}
+		resp := response{Status: http.StatusOK, Added: added, Users: entries}
+		if err != nil {
+			resp.Status, resp.Message = notSaved(err)
+		}
+		reply(w, resp.Status, resp)
+
+	}
+
+}
+
+// DeleteHandler removes a user and all of its keys from the ApiKey.uMap
+// authority; a dry run reports the keys that would be removed without
+// changing anything
 //
 // .../remove/{user}
+// .../remove/{user}?dryrun=true
 func (a *AuthKey) DeleteHandler() http.HandlerFunc {
 
 	type response struct {
-		Status  int    `json:"status"`
-		Message string `json:"message,omitempty"`
+		Status  int      `json:"status"`
+		Message string   `json:"message,omitempty"`
+		DryRun  bool     `json:"dryrun,omitempty"`
+		Keys    []string `json:"keys,omitempty"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		var resp response
 		user := chi.URLParam(r, "user")
-		log.Println("auth: delete", user)
-		a.delete(user)
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response{Message: user + " deleted"})
+		switch {
+		case a.fold(user) == a.admin:
+			resp = response{Status: http.StatusForbidden, Message: "admin can not be deleted"}
+		case dryRun(r):
+			if keys := a.keys(user); len(keys) > 0 {
+				resp = response{http.StatusOK, "dry run; " + user + " would be deleted", true, keys}
+			} else {
+				resp = response{http.StatusNotFound, user + " not found", true, nil}
+			}
+		default:
+			ok, err := a.delete(user)
+			if !ok {
+				resp = response{Status: http.StatusNotFound, Message: user + " not found"}
+				break
+			}
+			log.Println("auth: delete", user)
+			a.audit(r, "delete", a.fold(user))
+			resp = response{Status: http.StatusOK, Message: user + " deleted"}
+			if err != nil {
+				resp.Status, resp.Message = notSaved(err)
+			}
+		}
+
+		reply(w, resp.Status, resp)
 
 	}
 
 }
 
-// UpdateHandler reloads the ApiKey.uMap from disk
+// UpdateHandler replaces the apikey of a user with a new key; a dry run
+// reports the key that would be replaced without changing anything
 //
 // .../update/{user}
+// .../update/{user}?dryrun=true
 func (a *AuthKey) UpdateHandler() http.HandlerFunc {
 
 	type response struct {
-		Status  int    `json:"status"`
-		Message string `json:"message,omitempty"`
-		User    string `json:"user,omitempty"`
-		Key     string `json:"key,omitempty"`
+		Status  int      `json:"status"`
+		Message string   `json:"message,omitempty"`
+		User    string   `json:"user,omitempty"`
+		Key     string   `json:"key,omitempty"`
+		DryRun  bool     `json:"dryrun,omitempty"`
+		Keys    []string `json:"keys,omitempty"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var ok bool
+		var err error
 		var resp response
 		resp.User = chi.URLParam(r, "user")
-		resp.Key, ok = a.update(resp.User)
+
+		if dryRun(r) {
+			resp.DryRun = true
+			if resp.Keys = a.keys(resp.User); len(resp.Keys) > 0 && a.fold(resp.User) != a.admin {
+				resp.Status, resp.Message = http.StatusOK, "dry run; "+resp.User+" key would be replaced"
+			} else {
+				resp.Keys = nil
+				resp.Status, resp.Message = http.StatusNotFound, resp.User+" not found"
+			}
+			reply(w, resp.Status, resp)
+			return
+		}
+
+		resp.Key, ok, err = a.update(resp.User)
 		if ok {
+			resp.Status = http.StatusOK
 			if !a.silent {
 				log.Printf("auth: update %s [%s]", resp.User, resp.Key)
 			}
+			a.audit(r, "update", a.fold(resp.User))
+			if err != nil {
+				resp.Status, resp.Message = notSaved(err)
+			}
 		} else {
-			resp.Message = "failed"
+			resp.Status = http.StatusNotFound
+			resp.Message = resp.User + " not found"
 		}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(resp)
+		reply(w, resp.Status, resp)
+
+	}
+
+}
+
+// RotateHandler replaces the apikey of a user with a new key while the
+// old key stays valid for a grace period so clients can migrate without
+// downtime; both keys are returned {default:?grace=1h}
+//
+// .../rotate/{user}
+// .../rotate/{user}?grace=24h
+func (a *AuthKey) RotateHandler() http.HandlerFunc {
+
+	type response struct {
+		Status  int    `json:"status"`
+		Message string `json:"message,omitempty"`
+		User    string `json:"user,omitempty"`
+		Key     string `json:"key,omitempty"`
+		Old     string `json:"old,omitempty"`
+		Expires string `json:"expires,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		resp := response{User: chi.URLParam(r, "user")}
+
+		grace := time.Hour
+		if g := r.URL.Query().Get("grace"); len(g) > 0 {
+			d, err := time.ParseDuration(g)
+			if err != nil || d < 0 {
+				resp.Status, resp.Message = http.StatusBadRequest, "grace requires a duration; eg. 24h"
+				reply(w, resp.Status, resp)
+				return
+			}
+			grace = d
+		}
+
+		var until time.Time
+		var ok bool
+		var err error
+		switch {
+		case a.fold(resp.User) == a.admin:
+			resp.Status, resp.Message = http.StatusForbidden, "admin can not be rotated"
+		default:
+			if resp.Old, resp.Key, until, ok, err = a.rotate(resp.User, grace); ok {
+				resp.Status, resp.Expires = http.StatusOK, until.UTC().Format(time.RFC3339)
+				if !a.silent {
+					log.Printf("auth: rotate %s [%s]", resp.User, resp.Key)
+				}
+				a.audit(r, "rotate", a.fold(resp.User))
+				if err != nil {
+					resp.Status, resp.Message = notSaved(err)
+				}
+			} else {
+				resp.Status, resp.Message = http.StatusNotFound, resp.User+" not found"
+			}
+		}
+
+		reply(w, resp.Status, resp)
+
+	}
+
+}
+
+// DisableHandler suspends a user in the ApiKey.uMap authority while
+// retaining the key assignment
+//
+// .../disable/{user}
+func (a *AuthKey) DisableHandler() http.HandlerFunc { return a.stateHandler(true) }
+
+// EnableHandler restores a suspended user in the ApiKey.uMap authority
+//
+// .../enable/{user}
+func (a *AuthKey) EnableHandler() http.HandlerFunc { return a.stateHandler(false) }
+
+// stateHandler is the shared disable/enable handler
+func (a *AuthKey) stateHandler(off bool) http.HandlerFunc {
+
+	type response struct {
+		Status  int    `json:"status"`
+		Message string `json:"message,omitempty"`
+	}
+
+	action, event := "enabled", "enable"
+	if off {
+		action, event = "disabled", "disable"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var resp response
+		user := chi.URLParam(r, "user")
+		switch {
+		case a.fold(user) == a.admin:
+			resp = response{http.StatusForbidden, "admin can not be " + action}
+		default:
+			ok, err := a.disable(user, off)
+			if !ok {
+				resp = response{http.StatusNotFound, user + " not found"}
+				break
+			}
+			log.Printf("auth: %s %s", action, user)
+			a.audit(r, event, a.fold(user))
+			resp = response{http.StatusOK, user + " " + action}
+			if err != nil {
+				resp.Status, resp.Message = notSaved(err)
+			}
+		}
+
+		reply(w, resp.Status, resp)
 
 	}
 
@@ -328,56 +1371,196 @@ func (a *AuthKey) UpdateHandler() http.HandlerFunc {
 func (a *AuthKey) RefreshHandler() http.HandlerFunc {
 
 	type response struct {
-		Status  int    `json:"status,omitempty"`
+		Status  int    `json:"status"`
 		Message string `json:"message,omitempty"`
 		Keys    int    `json:"n,omitempty"`
+		Skipped int    `json:"skipped,omitempty"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		log.Println("auth: refresh")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response{Message: "refreshed", Keys: a.refresh()})
+		a.audit(r, "refresh", "")
+		n := a.refresh()
+		a.mu.Lock()
+		skipped := a.skipped
+		a.mu.Unlock()
+		reply(w, http.StatusOK, response{Status: http.StatusOK, Message: "refreshed", Keys: n, Skipped: skipped})
 
 	}
 
 }
 
-// UserHandler provides the current ApiKey.uMap
+// UserHandler provides the current ApiKey.uMap as a plain-text table or
+// as json with ?format=json; filtered by a case-insensitive user name
+// substring with ?q= and paged with ?offset= and ?limit= where limit
+// defaults to 1000 and is capped at 10000, and total counts the matches
 //
 // .../users
+// .../users?q=bob&offset=1000&limit=500&format=json
 func (a *AuthKey) UserHandler() http.HandlerFunc {
 
 	type user struct {
-		name, key string
+		Name string `json:"user"`
+		Key  string `json:"key"`
+		Off  bool   `json:"disabled,omitempty"`
+	}
+
+	type response struct {
+		Status int    `json:"status"`
+		Total  int    `json:"total"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+		Users  []user `json:"users"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		var users []user
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if offset < 0 {
+			offset = 0
+		}
+		switch {
+		case limit < 1:
+			limit = 1000
+		case limit > 10000:
+			limit = 10000
+		}
+
+		q := strings.ToLower(r.URL.Query().Get("q"))
+
+		// snapshot under lock; sorting and formatting happen after release
 		a.mu.Lock()
+		users := make([]user, 0, len(a.uMap))
 		for k := range a.uMap {
-			users = append(users, user{a.uMap[k], k})
+			if a.uMap[k] != a.admin && strings.Contains(strings.ToLower(a.uMap[k]), q) {
+				users = append(users, user{a.uMap[k], k, a.off[a.uMap[k]]})
+			}
 		}
 		a.mu.Unlock()
-		sort.Slice(users, func(i, j int) bool { return users[i].name < users[j].name })
+		sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
 		if !a.silent {
 			log.Printf("auth: users [%d]", len(users))
 		}
 
+		total := len(users)
+		if offset > total {
+			offset = total
+		}
+		if offset+limit < total {
+			users = users[offset : offset+limit]
+		} else {
+			users = users[offset:]
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			reply(w, http.StatusOK, response{http.StatusOK, total, offset, limit, users})
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "\n%s\n", strings.Repeat("-", 40))
-		fmt.Fprintf(w, "%-20s | %s\n", "user", a.hKey)
-		fmt.Fprintf(w, "%s\n", strings.Repeat("-", 40))
+
+		// stream the table through a buffered writer and append rows
+		// directly to avoid per-row fmt reflection on large maps
+		line := strings.Repeat("-", 40)
+		bw := bufio.NewWriterSize(w, 32<<10)
+		fmt.Fprintf(bw, "\n%s\n", line)
+		fmt.Fprintf(bw, "%-20s | %s\n", "user", a.hKey)
+		fmt.Fprintf(bw, "%s\n", line)
+		row := make([]byte, 0, 64)
 		for i := range users {
-			if users[i].name != a.admin {
-				fmt.Fprintf(w, "%-20s | %s\n", users[i].name, users[i].key)
+			row = append(row[:0], users[i].Name...)
+			for n := len(users[i].Name); n < 20; n++ {
+				row = append(row, ' ')
+			}
+			row = append(row, " | "...)
+			row = append(row, users[i].Key...)
+			if users[i].Off {
+				row = append(row, " | disabled"...)
 			}
+			row = append(row, '\n')
+			bw.Write(row)
 		}
-		fmt.Fprintf(w, "%s\n\n", strings.Repeat("-", 40))
+		fmt.Fprintf(bw, "%s\n", line)
+		fmt.Fprintf(bw, "%d-%d of %d\n\n", offset, offset+len(users), total)
+		bw.Flush()
+
+	}
 
+}
+
+// Users returns a sorted copy of the user names without their keys;
+// the admin is excluded as in the /a/users table
+func (a *AuthKey) Users() []string {
+
+	a.mu.Lock()
+	users := make([]string, 0, len(a.uMap))
+	for _, user := range a.uMap {
+		if user != a.admin {
+			users = append(users, user)
+		}
 	}
+	a.mu.Unlock()
 
+	sort.Strings(users)
+	return users
+}
+
+// NamesHandler provides the user names only, one per line or as json
+// with ?format=json, for dashboards that must not see the keys
+//
+// .../names
+// .../names?format=json
+func (a *AuthKey) NamesHandler() http.HandlerFunc {
+
+	type response struct {
+		Status int      `json:"status"`
+		Total  int      `json:"total"`
+		Users  []string `json:"users"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		users := a.Users()
+		if !a.silent {
+			log.Printf("auth: names [%d]", len(users))
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			reply(w, http.StatusOK, response{http.StatusOK, len(users), users})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bw := bufio.NewWriter(w)
+		for i := range users {
+			bw.WriteString(users[i])
+			bw.WriteByte('\n')
+		}
+		bw.Flush()
+
+	}
+
+}
+
+// notSaved is the admin response status and message for a mutation that
+// is in effect but was not saved and is lost on restart; 503 while the
+// keys file must not be overwritten until it is fixed, otherwise 500
+func notSaved(err error) (int, string) {
+	if errors.Is(err, ErrNotSaved) {
+		return http.StatusServiceUnavailable, "not saved; " + err.Error()
+	}
+	return http.StatusInternalServerError, "not saved; " + err.Error()
+}
+
+// reply writes a json admin response; the status must match the
+// response Status field and the header is written before the body
+func reply(w http.ResponseWriter, status int, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
 }
 
 //
@@ -398,27 +1581,109 @@ func (a *AuthKey) GetUser(r *http.Request) string {
 
 // IsValid middleware is restriced to valid users and requires
 // the http header have [a.hKey:{apikey}] set in the header however
-// it will failover and support /api/{key}/action formatting
-// within the url string in r.URL.Path
+// it will failover to Authorization: Bearer {apikey} and then support
+// /api/{key}/action formatting within the url string in r.URL.Path and
+// finally ?{hKey}={apikey} when QueryToken is enabled
 func (a *AuthKey) IsValid(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
+		if wait := a.lock.locked(r); wait > 0 {
+			tooMany(w, wait) // 429
+			return
+		}
+
 		apikey := r.Header.Get(a.hKey)
+		if len(apikey) == 0 { // failover to bearer
+			apikey = bearer(r)
+		}
 		if len(apikey) == 0 { // failover to url
 			apikey = chi.URLParam(r, a.hKey)
 		}
+		if len(apikey) == 0 && a.query { // failover to query
+			apikey = r.URL.Query().Get(a.hKey)
+		}
 
-		if user, ok := a.check(apikey); ok {
-			next.ServeHTTP(w, a.setUser(r, user))
+		if user, ok := a.checkCtx(r.Context(), apikey); ok {
+			a.accept(w, r, next, user)
 			return
 		}
 
+		if abandoned(w, r) {
+			return
+		}
+		if len(apikey) > 0 {
+			a.lock.fail(r)
+		}
 		w.WriteHeader(http.StatusUnauthorized)
 
 	})
 
 }
 
+// IsValidBasic middleware is IsValid for clients that can only send
+// http basic auth; the password is the apikey and a non-empty username
+// must match the key owner while the a.hKey header is still accepted
+//
+//	curl -u user:{apikey} https://example.com/private
+func (a *AuthKey) IsValidBasic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if wait := a.lock.locked(r); wait > 0 {
+			tooMany(w, wait) // 429
+			return
+		}
+
+		apikey := r.Header.Get(a.hKey)
+		if user, ok := a.checkCtx(r.Context(), apikey); ok {
+			a.accept(w, r, next, user)
+			return
+		}
+
+		if name, pass, ok := r.BasicAuth(); ok {
+			if user, ok := a.checkCtx(r.Context(), pass); ok && (len(name) == 0 || a.fold(name) == user) {
+				a.accept(w, r, next, user)
+				return
+			}
+			apikey = pass
+		}
+
+		if abandoned(w, r) {
+			return
+		}
+		if len(apikey) > 0 {
+			a.lock.fail(r)
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+		w.WriteHeader(http.StatusUnauthorized)
+
+	})
+}
+
+// bearer extracts the token from an Authorization: Bearer header
+func bearer(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// accept passes an authenticated user down the middleware chain or
+// responds 403 when the source address is not in the user allowlist
+func (a *AuthKey) accept(w http.ResponseWriter, r *http.Request, next http.Handler, user string) {
+	if !a.permit(user, r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	a.lock.reset(r)
+	r = a.setUser(r, user)
+	if a.onAuth != nil {
+		a.onAuth(user, r)
+	}
+	next.ServeHTTP(w, r)
+}
+
 // IsAdmin middleware is restricted to admin and requries that
 // {a.hKey}:{apikey} be set in the request header for access
 //
@@ -426,11 +1691,28 @@ func (a *AuthKey) IsValid(next http.Handler) http.Handler {
 func (a *AuthKey) IsAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		if user, ok := a.check(r.Header.Get(a.hKey)); ok && user == a.admin {
+		if wait := a.lock.locked(r); wait > 0 {
+			tooMany(w, wait) // 429
+			return
+		}
+
+		apikey := r.Header.Get(a.hKey)
+		if user, ok := a.checkCtx(r.Context(), apikey); ok && user == a.admin {
+			if !a.permit(user, r) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			a.lock.reset(r)
 			next.ServeHTTP(w, a.setUser(r, user))
 			return
 		}
 
+		if abandoned(w, r) {
+			return
+		}
+		if len(apikey) > 0 {
+			a.lock.fail(r)
+		}
 		w.WriteHeader(http.StatusUnauthorized)
 
 	})
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+)
+
+func TestUniqueKeyRetries(t *testing.T) {
+
+	a := new(AuthKey).Silent().Configure(nil)
+
+	taken := bytes.Repeat([]byte{0x11}, 8)
+	free := bytes.Repeat([]byte{0x22}, 8)
+	a.User("bob", hex.EncodeToString(taken))
+
+	// the first key collides with bob so the second must be used
+	a.rand = bytes.NewReader(append(taken, free...))
+	if key, _ := a.add("carol"); key != hex.EncodeToString(free) {
+		t.Fatalf("key = %s; want %s", key, hex.EncodeToString(free))
+	}
+	if user, ok := a.check(hex.EncodeToString(taken)); !ok || user != "bob" {
+		t.Fatalf("bob = %q %v; collision reassigned the key", user, ok)
+	}
+}
+
+func TestGenerateKeyFailingReader(t *testing.T) {
+
+	for name, src := range map[string]io.Reader{
+		"short":   bytes.NewReader([]byte{1, 2, 3}),
+		"failing": iotest.ErrReader(errors.New("no entropy")),
+	} {
+		a := new(AuthKey).Silent().Configure(nil)
+		a.rand = src
+		if key, _ := a.add("bob"); len(key) != 16 {
+			t.Errorf("%s: key = %q; want 16 hex characters", name, key)
+		}
+	}
+}
+
+func BenchmarkUserHandler(b *testing.B) {
+
+	a := new(AuthKey).Silent().Configure(nil)
+	for i := 0; i < 100000; i++ {
+		a.User(fmt.Sprintf("user%06d", i), fmt.Sprintf("%016x", i))
+	}
+	h := a.UserHandler()
+
+	for name, target := range map[string]string{
+		"text":  "/a/users",
+		"json":  "/a/users?format=json",
+		"query": "/a/users?q=user09&limit=10000",
+	} {
+		target := target
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+			}
+		})
+	}
+}
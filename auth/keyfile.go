@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// keys file formats
+const (
+	formatText = "text" // user apikey [off] [cidr,...]
+	formatCSV  = "csv"  // user,key,off,cidr with a header row
+	formatTSV  = "tsv"  // user	key	off	cidr with a header row
+)
+
+// Format selects the keys file format written by save as text, csv, or
+// tsv; when unset the format detected from the first line on load is kept
+// so a provisioning file round-trips in its own format, and selecting a
+// different format converts the file on the next save {default:detected}
+//
+// csv and tsv files may carry a header row naming the columns, eg.
+// user,key,role,expiry, where user and key are required, off and cidr are
+// understood, and any other column is preserved as is
+func (a *AuthKey) Format(format string) *AuthKey {
+	switch format = strings.ToLower(format); format {
+	case formatText, formatCSV, formatTSV:
+		a.format = format
+	default:
+		log.Printf("auth: unknown format %q", format)
+	}
+	return a
+}
+
+// sniff detects the keys file format from the first non-empty line that
+// is not a # comment; a text line only has commas in its trailing cidr
+// list so a comma within the first field, eg. "bob, key", or a header
+// naming the user and key columns is csv
+func sniff(br *bufio.Reader) string {
+	b, _ := br.Peek(4096)
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		switch {
+		case strings.Contains(line, "\t"):
+			return formatTSV
+		case strings.Contains(strings.Fields(line)[0], ","), csvHeader(line):
+			return formatCSV
+		}
+		return formatText
+	}
+	return formatText
+}
+
+// csvHeader reports a comma separated line naming the user and key columns
+func csvHeader(line string) bool {
+	var user, key bool
+	for _, name := range strings.Split(line, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "user":
+			user = true
+		case "key":
+			key = true
+		}
+	}
+	return user && key
+}
+
+// writeFormat is the Format selection or the detected format
+func (a *AuthKey) writeFormat() string {
+	if len(a.format) > 0 {
+		return a.format
+	}
+	if len(a.detected) > 0 {
+		return a.detected
+	}
+	return formatText
+}
+
+// comma is the csv.Reader/Writer separator for format
+func comma(format string) rune {
+	if format == formatTSV {
+		return '\t'
+	}
+	return ','
+}
+
+// loadText reads user apikey [off] [cidr,...] lines; malformed lines are
+// skipped so that a zero-length key can never match an empty token, blank
+// lines are ignored, and # comment lines are kept so that save writes them
+// back; a comment block directly above a user line stays with that user
+// and any other block is written at the top of the file; the caller holds
+// the lock
+func (a *AuthKey) loadText(r io.Reader) (n int) {
+
+	var line int
+	var notes []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(text) == 0:
+			a.notes[""] = append(a.notes[""], notes...) // detached
+			notes = nil
+			continue
+		case text[0] == '#':
+			notes = append(notes, text)
+			continue
+		}
+
+		fields := strings.Fields(text)
+		var off bool
+		var list []netip.Prefix
+		ok := len(fields) >= 2 && len(fields) <= 4
+		for i := 2; ok && i < len(fields); i++ {
+			switch {
+			case fields[i] == "off" && !off && list == nil:
+				off = true
+			case list == nil:
+				var err error
+				list, err = parseCIDR(fields[i])
+				ok = err == nil && len(list) > 0
+			default:
+				ok = false
+			}
+		}
+		if !ok {
+			a.malformed(line)
+			continue
+		}
+
+		a.load(fields[0], fields[1], off, list, nil)
+		if notes != nil {
+			a.notes[a.fold(fields[0])] = notes
+			notes = nil
+		}
+		n++
+	}
+	a.notes[""] = append(a.notes[""], notes...) // trailing
+	if err := scanner.Err(); err != nil {
+		log.Printf("auth: load @%s %v", *a.path, err)
+		a.loadErr = err
+	}
+
+	return
+}
+
+// loadCSV reads csv or tsv records where an optional header row names the
+// columns, otherwise the columns are user,key,off,cidr in order; the caller
+// holds the lock
+func (a *AuthKey) loadCSV(r io.Reader, format string) (n int) {
+
+	cr := csv.NewReader(r)
+	cr.Comma = comma(format)
+	cr.Comment = '#' // skipped; comments are not kept in csv/tsv files
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = format == formatCSV // "user, key" separators
+
+	col := make(map[string]int)
+
+	for line := 1; ; line++ {
+
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				log.Printf("auth: load @%s %v", *a.path, err)
+				a.loadErr = err
+				break
+			}
+			a.malformed(line)
+			continue
+		}
+
+		// the first record is a header when it names user and key columns
+		if a.header == nil {
+			for i := range rec {
+				col[strings.ToLower(strings.TrimSpace(rec[i]))] = i
+			}
+			_, hasUser := col["user"]
+			_, hasKey := col["key"]
+			if hasUser && hasKey {
+				a.header = append([]string(nil), rec...)
+				continue
+			}
+			col = map[string]int{"user": 0, "key": 1, "off": 2, "cidr": 3}
+			a.header, a.noHeader = []string{"user", "key", "off", "cidr"}, true
+		}
+
+		// columns past a headerless user,key,off,cidr are kept by position
+		for len(a.header) < len(rec) {
+			a.header = append(a.header, fmt.Sprintf("_%d", len(a.header)+1))
+		}
+
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		user, key := field("user"), field("key")
+		var list []netip.Prefix
+		ok := len(user) > 0 && len(key) > 0
+		if c := field("cidr"); ok && len(c) > 0 {
+			list, err = parseCIDR(c)
+			ok = err == nil
+		}
+		if !ok {
+			a.malformed(line)
+			continue
+		}
+
+		var extra map[string]string
+		for i := range rec {
+			name := strings.ToLower(strings.TrimSpace(a.header[i]))
+			switch name {
+			case "user", "key", "off", "cidr":
+			default:
+				if extra == nil {
+					extra = make(map[string]string)
+				}
+				extra[a.header[i]] = rec[i]
+			}
+		}
+
+		switch strings.ToLower(field("off")) {
+		case "off", "true", "1", "yes", "disabled":
+			a.load(user, key, true, list, extra)
+		default:
+			a.load(user, key, false, list, extra)
+		}
+		n++
+	}
+
+	return
+}
+
+// load a user record into the maps; the caller holds the lock
+func (a *AuthKey) load(user, key string, off bool, list []netip.Prefix, extra map[string]string) {
+	user, key = a.fold(user), a.fold(key)
+	a.uMap[key] = user
+	if off {
+		a.off[user] = true
+	}
+	if list != nil {
+		a.cidr[user] = list
+	}
+	if extra != nil {
+		a.extra[user] = extra
+	}
+}
+
+// malformed counts and reports a skipped keys file line; the caller
+// holds the lock
+func (a *AuthKey) malformed(line int) {
+	a.skipped++
+	if !a.silent {
+		log.Printf("auth: load @%s:%d malformed line skipped", *a.path, line)
+	}
+}
+
+// cidrString formats the user allowlist as a comma list
+func (a *AuthKey) cidrString(user string) string {
+	list := a.cidr[user]
+	cidr := make([]string, len(list))
+	for i := range list {
+		cidr[i] = list[i].String()
+	}
+	return strings.Join(cidr, ",")
+}
+
+// writeText writes user apikey [off] [cidr,...] lines sorted by user with
+// the loaded # comments ahead of their user line and the detached comments
+// first followed by a blank line; the caller holds the lock
+func (a *AuthKey) writeText(w io.Writer) {
+
+	for _, note := range a.notes[""] {
+		fmt.Fprintln(w, note)
+	}
+	if len(a.notes[""]) > 0 {
+		fmt.Fprintln(w) // keeps them detached from the first user on reload
+	}
+
+	keys := make([]string, 0, len(a.uMap))
+	for k := range a.uMap {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return a.uMap[keys[i]] < a.uMap[keys[j]] })
+
+	for _, k := range keys {
+		user := a.uMap[k]
+		for _, note := range a.notes[user] {
+			fmt.Fprintln(w, note)
+		}
+		fmt.Fprint(w, user, " ", k)
+		if a.off[user] {
+			fmt.Fprint(w, " off")
+		}
+		if len(a.cidr[user]) > 0 {
+			fmt.Fprint(w, " ", a.cidrString(user))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeCSV writes csv or tsv records in the loaded column order, adding
+// the off and cidr columns only when a user needs them; the caller holds
+// the lock
+func (a *AuthKey) writeCSV(w io.Writer, format string) error {
+
+	header := a.header
+	if header == nil {
+		header = []string{"user", "key"}
+	}
+
+	has := make(map[string]bool)
+	for i := range header {
+		has[strings.ToLower(strings.TrimSpace(header[i]))] = true
+	}
+	if !has["off"] && len(a.off) > 0 {
+		header = append(header[:len(header):len(header)], "off")
+	}
+	if !has["cidr"] && len(a.cidr) > 0 {
+		header = append(header[:len(header):len(header)], "cidr")
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = comma(format)
+	if !a.noHeader || len(header) != len(a.header) {
+		cw.Write(header)
+	}
+
+	keys := make([]string, 0, len(a.uMap))
+	for k := range a.uMap {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return a.uMap[keys[i]] < a.uMap[keys[j]] })
+
+	rec := make([]string, len(header))
+	for _, k := range keys {
+		user := a.uMap[k]
+		for i := range header {
+			switch strings.ToLower(strings.TrimSpace(header[i])) {
+			case "user":
+				rec[i] = user
+			case "key":
+				rec[i] = k
+			case "off":
+				rec[i] = ""
+				if a.off[user] {
+					rec[i] = "off"
+				}
+			case "cidr":
+				rec[i] = a.cidrString(user)
+			default:
+				rec[i] = a.extra[user][header[i]]
+			}
+		}
+		cw.Write(rec)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeFileAtomic writes data to a temp file in the directory of path
+// and renames it into place so readers never observe a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+
+	err = f.Chmod(perm)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// lockoutMax bounds the tracked source addresses
+const lockoutMax = 10000
+
+// lockout tracks failed authentication attempts per source address and
+// locks an address out for a cooldown after n failures within a window
+type lockout struct {
+	mu       sync.Mutex
+	n        int                // failures that trigger a lockout
+	window   time.Duration      // failure counting window
+	cooldown time.Duration      // lockout duration
+	strikes  map[string]*strike // source address->failures
+}
+
+// strike is the failure state of a source address
+type strike struct {
+	count int       // failures within the window
+	first time.Time // window start
+	until time.Time // locked out until
+}
+
+// newLockout configurator; n < 1 disables the lockout
+func newLockout(n int, window, cooldown time.Duration) *lockout {
+	if n < 1 {
+		return nil
+	}
+	return &lockout{n: n, window: window, cooldown: cooldown, strikes: make(map[string]*strike)}
+}
+
+// source is the request address without the port
+func source(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// locked reports the remaining lockout of the request source address
+func (l *lockout) locked(r *http.Request) time.Duration {
+
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, ok := l.strikes[source(r)]; ok {
+		return time.Until(s.until)
+	}
+	return 0
+}
+
+// fail records a failed attempt from the request source address
+func (l *lockout) fail(r *http.Request) {
+
+	if l == nil {
+		return
+	}
+
+	now := time.Now()
+	ip := source(r)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.strikes[ip]
+	if !ok {
+		if len(l.strikes) >= lockoutMax {
+			if l.prune(now); len(l.strikes) >= lockoutMax {
+				return // every address is locked out; not tracked
+			}
+		}
+		s = &strike{first: now}
+		l.strikes[ip] = s
+	}
+	if now.Sub(s.first) > l.window {
+		s.count, s.first = 0, now
+	}
+	if s.count++; s.count >= l.n {
+		s.count, s.first, s.until = 0, now, now.Add(l.cooldown)
+	}
+}
+
+// reset clears the request source address after a successful attempt
+func (l *lockout) reset(r *http.Request) {
+
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	delete(l.strikes, source(r))
+	l.mu.Unlock()
+}
+
+// prune drops expired addresses and, when still at the bound, an
+// address that is counting failures but is not locked out so the map
+// can not grow without limit; a locked out address is never dropped
+// since that would lift its lockout early
+func (l *lockout) prune(now time.Time) {
+	for ip, s := range l.strikes {
+		if now.After(s.until) && now.Sub(s.first) > l.window {
+			delete(l.strikes, ip)
+		}
+	}
+	for ip, s := range l.strikes {
+		if len(l.strikes) < lockoutMax {
+			break
+		}
+		if now.After(s.until) {
+			delete(l.strikes, ip)
+		}
+	}
+}
+
+// tooMany responds 429 with the remaining lockout as Retry-After
+func tooMany(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockoutPruneKeepsLocked(t *testing.T) {
+
+	l := newLockout(1, time.Minute, time.Hour)
+	r := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < lockoutMax; i++ {
+		r.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+		l.fail(r) // n=1 locks out on the first failure
+	}
+
+	r.RemoteAddr = "192.0.2.1:1234"
+	l.fail(r)
+
+	r.RemoteAddr = "10.0.0.0:1234"
+	if l.locked(r) <= 0 {
+		t.Fatal("locked out address was evicted")
+	}
+	if len(l.strikes) > lockoutMax {
+		t.Fatalf("tracked %d addresses; bound is %d", len(l.strikes), lockoutMax)
+	}
+}
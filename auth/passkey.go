@@ -7,66 +7,130 @@ import (
 	"crypto/sha1"
 	"encoding/base32"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 )
 
+// PassKey secret validation errors
+var (
+	ErrSecretLength   = errors.New("passkey: secret is empty")
+	ErrSecretEncoding = errors.New("passkey: secret is not valid base32 (A..Z,2..7)")
+	ErrSecretType     = errors.New("passkey: secret type is not supported")
+)
+
 // Client interface that exposes the minimal PassKey
 // methods that a client needs to access for authentication
 type Client interface {
-	Configure(interface{}) *PassKey
 	Interval(interface{}) *PassKey
 	Start(context.Context)
 	Current() uint32
+	CurrentString() string
+	Transport(http.RoundTripper) http.RoundTripper
 }
 
 // NewClient configures a PassKey with the provided secret
-// to allow authentical with a PassKey enabled server
+// to allow authentical with a PassKey enabled server; an
+// invalid secret returns a nil Client and the reason
 //
-//	var pkc = passkey.NewClient(secret)
+//	pkc, err := auth.NewClient(secret)
+//	if err != nil {
+//	 return err
+//	}
 //	pkc.Start(ctx)
 //	for {
-//	 req.Header.Set("token",pkc.Current())
+//	 req.Header.Set("token",pkc.CurrentString())
 //	}
-func NewClient(secret interface{}) Client {
-	var pk = new(PassKey).Configure(secret)
-	return pk
+func NewClient(secret interface{}) (Client, error) {
+	pk := new(PassKey)
+	if err := pk.configure(secret); err != nil {
+		return nil, err
+	}
+	return pk, nil
 }
 
 // PassKey structure to generate a time based token set
 // based on a shared secret for system-to-system
 // machine communication with rolling authentication
 type PassKey struct {
-	interval time.Duration    // defaults to one-minute
-	key      [20]byte         // binary form of secret
-	tokens   [3]atomic.Uint32 // interval tokens
-	hKey     string           // header key name; token
+	interval atomic.Int64        // time.Duration; defaults to one-minute
+	retune   chan struct{}       // interval change signal for Start
+	key      []byte              // binary form of secret
+	tokens   [3]atomic.Uint32    // interval tokens
+	hKey     string              // header key name; token
+	file     string              // current token file; off when empty
+	onAuth   func(*http.Request) // successful validation hook
+	passed   atomic.Uint64       // successful validations
+	failed   atomic.Uint64       // failed validations
+	epoch    atomic.Int64        // current token interval boundary; unix
+	now      func() time.Time    // clock; time.Now when nil
 }
 
 // NewPassKey configurator used the provided secret or generates a
 // secret on initilization that can be exported and then shared
 //
-//	default: generate new secret with default one-minute interval
-//	accepts: nil, [20]byte slice, or a base32(A..Z,2...7) 32-character string
+//	default: generate new 20-byte secret with default one-minute interval
+//	accepts: nil, [20]byte, []byte, or a base32(A..Z,2...7) string of any length
 //	eg. AW6TJVTYMAYJXLWFW2WWJ6D3Q5B2AY25
 func NewPassKey(secret interface{}) *PassKey {
-	return new(PassKey).Configure(secret)
+	pk, _ := NewPassKeyErr(secret)
+	return pk
+}
+
+// NewPassKeyErr is NewPassKey that reports why a secret was rejected;
+// ErrSecretLength, ErrSecretEncoding, or ErrSecretType
+//
+//	pk, err := auth.NewPassKeyErr(secret)
+//	if err != nil {
+//	 log.Fatal(err)
+//	}
+func NewPassKeyErr(secret interface{}) (*PassKey, error) {
+	pk := new(PassKey)
+	if err := pk.configure(secret); err != nil {
+		return nil, err
+	}
+	return pk, nil
 }
 
 // HKey sets the header key name; {default:token}
 func (pk *PassKey) HKey(key string) *PassKey { pk.hKey = key; return pk }
 
-// User will
+// OnAuthSuccess sets a hook invoked by IsValid after each successful
+// token validation; there is no user so only the request is provided
+func (pk *PassKey) OnAuthSuccess(fn func(r *http.Request)) *PassKey {
+	pk.onAuth = fn
+	return pk
+}
+
+// TokenFile sets a file that receives the current token on each roll so
+// that non-Go clients can simply read it; {default:off}
+func (pk *PassKey) TokenFile(path string) *PassKey {
+	pk.file = path
+	pk.writeToken()
+	return pk
+}
+
 // Configure applies the provided secret or generates a new one
 // and generates a new token set based off the current pk.interval
 //
-//	default: generate new
-//	accepts: nil, [20]byte slice, or a base32(A..Z,2...7) 32-character string
+//	default: generate new 20-byte secret
+//	accepts: nil, [20]byte, []byte, or a base32(A..Z,2...7) string of any length
 //	eg. AW6TJVTYMAYJXLWFW2WWJ6D3Q5B2AY25
 func (pk *PassKey) Configure(secret interface{}) *PassKey {
+	if pk.configure(secret) != nil {
+		return nil
+	}
+	return pk
+}
+
+// configure applies the secret and reports why a secret was rejected
+func (pk *PassKey) configure(secret interface{}) error {
 
 	// set default hKey
 	if len(pk.hKey) == 0 {
@@ -76,27 +140,40 @@ func (pk *PassKey) Configure(secret interface{}) *PassKey {
 	// apply provided secret or generate a new one
 	switch a := secret.(type) {
 	case string:
-		if len(a) != 32 {
-			return nil
+		if len(a) == 0 {
+			return ErrSecretLength
 		}
 		b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(a))
 		if err != nil {
-			return nil
+			return ErrSecretEncoding
 		}
-		copy(pk.key[:], b)
+		pk.key = b
 
 	case [20]byte:
-		copy(pk.key[:], a[:])
+		pk.key = append([]byte(nil), a[:]...)
 
-	default: // nil
-		rand.Read(pk.key[:])
+	case []byte:
+		if len(a) == 0 {
+			return ErrSecretLength
+		}
+		pk.key = append([]byte(nil), a...)
+
+	case nil:
+		pk.key = make([]byte, 20)
+		rand.Read(pk.key)
+
+	default:
+		return fmt.Errorf("%w: %T", ErrSecretType, secret)
 
 	}
 
 	// generate a new token set
-	pk.Interval(pk.interval)
+	if pk.retune == nil {
+		pk.retune = make(chan struct{}, 1)
+	}
+	pk.Interval(nil)
 
-	return pk
+	return nil
 }
 
 // Interval sets the time duration and generates a token set
@@ -105,32 +182,59 @@ func (pk *PassKey) Configure(secret interface{}) *PassKey {
 //	accepts: nil, time.Duration, or int value of seconds
 func (pk *PassKey) Interval(interval interface{}) *PassKey {
 
+	d := pk.period()
 	switch a := interval.(type) {
 	case nil: // does nothing
 	case time.Duration:
-		pk.interval = a
+		d = a
 
 	case int: // as seconds
-		pk.interval = time.Duration(a) * time.Second
+		d = time.Duration(a) * time.Second
 	}
 
-	if pk.interval == 0 { // set default
-		pk.interval = time.Minute
+	if d <= 0 { // set default
+		d = time.Minute
+	}
+
+	pk.interval.Store(int64(d))
+	pk.token()
+
+	// a running Start picks up the new cadence
+	select {
+	case pk.retune <- struct{}{}:
+	default:
 	}
 
+	return pk
+}
+
+// Clock sets the time source used to generate the token set and
+// regenerates it; set before Start, eg. a fixed time for deterministic
+// tests of interval boundaries {default:time.Now}
+//
+//	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+//	pk.Clock(func() time.Time { return at })
+func (pk *PassKey) Clock(now func() time.Time) *PassKey {
+	pk.now = now
 	pk.token()
 	return pk
 }
 
-// Start interval token PassKey
+// period is the current interval
+func (pk *PassKey) period() time.Duration { return time.Duration(pk.interval.Load()) }
+
+// Start interval token PassKey; an Interval change while running
+// resets the roll timer to the new cadence
 func (pk *PassKey) Start(ctx context.Context) {
 
-	tick := time.NewTicker(pk.interval)
+	tick := time.NewTicker(pk.period())
 	defer tick.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-pk.retune:
+			tick.Reset(pk.period())
 		case <-tick.C:
 			pk.token()
 		}
@@ -143,6 +247,33 @@ func (pk *PassKey) Secret() string {
 	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(pk.key[:])
 }
 
+// URI provides an otpauth provisioning uri carrying the base32 secret and
+// interval period for bootstrapping a peer from a QR code; PassKey tokens
+// are not RFC 6238 codes so an authenticator app will not produce matching
+// tokens, the uri is for a peer that configures a PassKey from it and
+// digits is the widest decimal uint32 token
+//
+//	otpauth://totp/issuer:account?algorithm=SHA1&digits=10&issuer=issuer&period=60&secret=...
+func (pk *PassKey) URI(issuer, account string) string {
+
+	label := account
+	if len(issuer) > 0 {
+		label = issuer + ":" + account
+	}
+
+	q := url.Values{}
+	q.Set("secret", pk.Secret())
+	q.Set("period", strconv.Itoa(int(pk.period()/time.Second)))
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", "10")
+	if len(issuer) > 0 {
+		q.Set("issuer", issuer)
+	}
+
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}
+	return u.String()
+}
+
 // Tokens return the current token set
 func (pk *PassKey) Tokens() []uint32 {
 	return []uint32{pk.tokens[0].Load(), pk.tokens[1].Load(), pk.tokens[2].Load()}
@@ -151,9 +282,63 @@ func (pk *PassKey) Tokens() []uint32 {
 // Current token
 func (pk *PassKey) Current() uint32 { return pk.tokens[1].Load() }
 
+// CurrentString is the current token formatted for a header value the
+// way the IsValid middleware parses it
+func (pk *PassKey) CurrentString() string {
+	return strconv.FormatUint(uint64(pk.Current()), 10)
+}
+
+// TokensString return the current token set formatted for header values
+func (pk *PassKey) TokensString() []string {
+	tokens := pk.Tokens()
+	s := make([]string, len(tokens))
+	for i := range tokens {
+		s[i] = strconv.FormatUint(uint64(tokens[i]), 10)
+	}
+	return s
+}
+
+// transport injects the current token into outgoing requests
+type transport struct {
+	pk   *PassKey
+	base http.RoundTripper
+}
+
+// RoundTrip sets the token header on a clone of the request since a
+// RoundTripper must not modify the caller's request
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(t.pk.hKey, t.pk.CurrentString())
+	return t.base.RoundTrip(r)
+}
+
+// Transport wraps base (http.DefaultTransport when nil) with a RoundTripper
+// that sets the current token on every request; the token follows the
+// interval rolls of a started PassKey and other headers are untouched
+//
+//	client := &http.Client{Transport: pkc.Transport(nil)}
+func (pk *PassKey) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{pk: pk, base: base}
+}
+
 // Validate the current token
 func (pk *PassKey) Validate(token uint32) bool {
 
+	if !pk.match(token) {
+		pk.failed.Add(1)
+		return false
+	}
+
+	pk.passed.Add(1)
+	return true
+
+}
+
+// match reports a token in the token set without counting it
+func (pk *PassKey) match(token uint32) bool {
 	switch token {
 	case pk.tokens[1].Load(): // current
 	case pk.tokens[0].Load(): // previous
@@ -161,21 +346,89 @@ func (pk *PassKey) Validate(token uint32) bool {
 	default:
 		return false
 	}
-
 	return true
+}
+
+// ValidateString validates a token in its header string form; surrounding
+// whitespace is trimmed and a value that does not parse as a uint32 is
+// rejected so that a parse failure can never become a zero token that
+// happens to match
+func (pk *PassKey) ValidateString(s string) bool {
+	token, ok := parseToken(s)
+	if !ok {
+		pk.failed.Add(1)
+		return false
+	}
+	return pk.Validate(token)
+}
+
+// parseToken parses a token in its header string form; see ValidateString
+func parseToken(s string) (uint32, bool) {
+	token, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+	return uint32(token), err == nil
+}
+
+// PassKeyMetrics is a snapshot of the PassKey validation counters and the
+// interval boundary the current token is derived from; a rising failure
+// rate with a steady client count points to clients stuck on an old
+// token or to clock drift
+type PassKeyMetrics struct {
+	Passed   uint64        `json:"passed"`
+	Failed   uint64        `json:"failed"`
+	Boundary time.Time     `json:"boundary"`
+	Interval time.Duration `json:"interval"`
+}
+
+// Metrics provides a snapshot of the validation counters
+func (pk *PassKey) Metrics() PassKeyMetrics {
+	return PassKeyMetrics{
+		Passed:   pk.passed.Load(),
+		Failed:   pk.failed.Load(),
+		Boundary: time.Unix(pk.epoch.Load(), 0),
+		Interval: pk.period(),
+	}
+}
 
+// MetricsHandler serves the Metrics snapshot in the prometheus text format
+// for scraping; protect it like any other internal route
+//
+//	router.With(ak.IsAdmin).Get("/x/passkey", pk.MetricsHandler())
+func (pk *PassKey) MetricsHandler() http.HandlerFunc { return metricsHandler(pk.Metrics) }
+
+// metricsHandler serves a PassKey or PassKeySet metrics snapshot
+func metricsHandler(metrics func() PassKeyMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := metrics()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		fmt.Fprintf(w, "# TYPE passkey_validations_total counter\n")
+		fmt.Fprintf(w, "passkey_validations_total{result=\"passed\"} %d\n", m.Passed)
+		fmt.Fprintf(w, "passkey_validations_total{result=\"failed\"} %d\n", m.Failed)
+		fmt.Fprintf(w, "# TYPE passkey_interval_boundary_seconds gauge\n")
+		fmt.Fprintf(w, "passkey_interval_boundary_seconds %d\n", m.Boundary.Unix())
+		fmt.Fprintf(w, "# TYPE passkey_interval_seconds gauge\n")
+		fmt.Fprintf(w, "passkey_interval_seconds %g\n", m.Interval.Seconds())
+	}
 }
 
 // generate a token set using the shared secret and time interval
 func (pk *PassKey) token() {
 
+	now := time.Now
+	if pk.now != nil {
+		now = pk.now
+	}
+
 	// previous, current, next tokens
+	at, interval := now(), pk.period()
 	for i := range pk.tokens {
 
+		boundary := at.Add(time.Duration(i-1) * interval).Round(interval).Unix()
+		if i == 1 {
+			pk.epoch.Store(boundary)
+		}
+
 		bs := make([]byte, 8)
-		binary.LittleEndian.PutUint64(bs, uint64(
-			time.Now().Add(time.Duration(i-1)*pk.interval).Round(pk.interval).Unix(),
-		))
+		binary.LittleEndian.PutUint64(bs, uint64(boundary))
 
 		// sign the value using HMAC-SHA1 algorithm
 		hash := hmac.New(sha1.New, pk.key[:])
@@ -190,6 +443,22 @@ func (pk *PassKey) token() {
 
 	}
 
+	pk.writeToken()
+
+}
+
+// writeToken atomically writes the current token to pk.file using a temp
+// file and rename; the token is a credential so the file is owner only
+func (pk *PassKey) writeToken() {
+
+	if len(pk.file) == 0 {
+		return
+	}
+
+	if err := writeFileAtomic(pk.file, []byte(pk.CurrentString()+"\n"), 0600); err != nil {
+		log.Println("auth: token file", err)
+	}
+
 }
 
 //
@@ -201,13 +470,12 @@ func (pk *PassKey) token() {
 func (pk *PassKey) IsValid(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		passkey := r.Header.Get((pk.hKey))
-		if len(passkey) > 0 {
-			tok, _ := strconv.Atoi(passkey)
-			if pk.Validate(uint32(tok)) {
-				next.ServeHTTP(w, r)
-				return
+		if passkey := r.Header.Get(pk.hKey); len(passkey) > 0 && pk.ValidateString(passkey) {
+			if pk.onAuth != nil {
+				pk.onAuth(r)
 			}
+			next.ServeHTTP(w, r)
+			return
 		}
 
 		w.WriteHeader(http.StatusUnauthorized)
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewClientBadSecret(t *testing.T) {
+
+	for _, tc := range []struct {
+		secret interface{}
+		err    error
+	}{
+		{"not-base32!", ErrSecretEncoding},
+		{"AW6TJVTYMAYJXLWF0189", ErrSecretEncoding}, // 0, 1, 8, 9 are not base32
+		{"", ErrSecretLength},
+		{42, ErrSecretType},
+	} {
+		pkc, err := NewClient(tc.secret)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("NewClient(%v) err = %v; want %v", tc.secret, err, tc.err)
+		}
+		if pkc != nil {
+			t.Errorf("NewClient(%v) returned a client with an invalid secret", tc.secret)
+		}
+	}
+
+	if _, err := NewClient("AW6TJVTYMAYJXLWFW2WWJ6D3Q5B2AY25"); err != nil {
+		t.Fatalf("NewClient valid secret: %v", err)
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+
+	pk := NewPassKey("AW6TJVTYMAYJXLWFW2WWJ6D3Q5B2AY25").Interval(30)
+
+	u, err := url.Parse(pk.URI("example", "bob@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/example:bob@example.com" {
+		t.Fatalf("uri = %s; want otpauth://totp/example:bob@example.com", u)
+	}
+
+	q := u.Query()
+	for name, want := range map[string]string{
+		"secret":    pk.Secret(),
+		"period":    "30",
+		"digits":    "10",
+		"algorithm": "SHA1",
+		"issuer":    "example",
+	} {
+		if got := q.Get(name); got != want {
+			t.Errorf("%s = %q; want %q", name, got, want)
+		}
+	}
+
+	// a peer configured from the uri produces the same tokens
+	period, _ := strconv.Atoi(q.Get("period"))
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	peer, err := NewPassKeyErr(q.Get("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.Interval(period).Clock(func() time.Time { return at })
+	pk.Clock(func() time.Time { return at })
+	if peer.Current() != pk.Current() {
+		t.Fatalf("peer token %d; want %d", peer.Current(), pk.Current())
+	}
+	if digits, _ := strconv.Atoi(q.Get("digits")); len(pk.CurrentString()) > digits {
+		t.Fatalf("token %s is wider than %d digits", pk.CurrentString(), digits)
+	}
+}
+
+func TestClockBoundaries(t *testing.T) {
+
+	const secret = "AW6TJVTYMAYJXLWFW2WWJ6D3Q5B2AY25"
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	pkAt := func(now time.Time) *PassKey {
+		return NewPassKey(secret).Clock(func() time.Time { return now })
+	}
+
+	// the same clock always produces the same token set
+	pk := pkAt(at)
+	if again := pkAt(at); again.Current() != pk.Current() {
+		t.Fatalf("tokens differ for the same clock")
+	}
+	if m := pk.Metrics(); !m.Boundary.Equal(at) {
+		t.Fatalf("boundary = %v; want %v", m.Boundary, at)
+	}
+
+	// a token generated on the boundary validates in both adjacent windows
+	// and not two windows away
+	token := pk.Current()
+	for _, tc := range []struct {
+		offset time.Duration
+		ok     bool
+	}{
+		{-time.Minute, true},
+		{0, true},
+		{time.Minute, true},
+		{-time.Minute * 2, false},
+		{time.Minute * 2, false},
+	} {
+		if ok := pkAt(at.Add(tc.offset)).Validate(token); ok != tc.ok {
+			t.Errorf("token from %v validated at %v = %v; want %v", at, tc.offset, ok, tc.ok)
+		}
+	}
+
+	// windows are centered on the rounded time so the current token rolls
+	// half an interval past it and the old token is then the previous
+	before, after := pkAt(at.Add(time.Second*30-time.Nanosecond)), pkAt(at.Add(time.Second*30))
+	if before.Current() != token {
+		t.Fatalf("token rolled before the window ended")
+	}
+	if after.Current() == token || after.Tokens()[0] != token {
+		t.Fatalf("token did not roll to the next window at the boundary")
+	}
+}
+
+func TestPassKeySetRemove(t *testing.T) {
+
+	set := NewPassKeySet(NewPassKey("AW6TJVTYMAYJXLWFW2WWJ6D3Q5B2AY25"), NewPassKey(nil))
+
+	if set.Remove("QQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQQ") {
+		t.Fatal("removed a secret that is not a member")
+	}
+	if !set.Remove(" aw6tjvtymayjxlwfw2wwj6d3q5b2ay25\n") {
+		t.Fatal("lower case secret with whitespace was not removed")
+	}
+	if set.Len() != 1 {
+		t.Fatalf("len = %d; want 1", set.Len())
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// PassKeySet accepts a token that is valid under any member PassKey so
+// that a shared secret can be rotated without a flag-day; add the new
+// secret, migrate the clients, then remove the old secret
+//
+//	set := auth.NewPassKeySet(auth.NewPassKey(oldSecret), auth.NewPassKey(newSecret))
+//	grace.Manager(set) // set.Start; roll timers
+//	router.With(set.IsValid).Get("/private", handler)
+//	...
+//	set.Remove(oldSecret) // after the clients have migrated
+type PassKeySet struct {
+	mu     sync.RWMutex
+	keys   []*PassKey
+	cancel map[*PassKey]context.CancelFunc // running members
+	ctx    context.Context                 // set by Start
+	hKey   string                          // header key name; token
+	onAuth func(*http.Request)             // successful validation hook
+	passed atomic.Uint64                   // successful validations
+	failed atomic.Uint64                   // failed validations
+}
+
+// NewPassKeySet configurator with the provided members; nil members
+// are ignored
+func NewPassKeySet(keys ...*PassKey) *PassKeySet {
+	set := &PassKeySet{hKey: "token", cancel: make(map[*PassKey]context.CancelFunc)}
+	for i := range keys {
+		set.Add(keys[i])
+	}
+	return set
+}
+
+// HKey sets the header key name; {default:token}
+func (set *PassKeySet) HKey(key string) *PassKeySet { set.hKey = key; return set }
+
+// OnAuthSuccess sets a hook invoked by IsValid after each successful
+// token validation
+func (set *PassKeySet) OnAuthSuccess(fn func(r *http.Request)) *PassKeySet {
+	set.onAuth = fn
+	return set
+}
+
+// Add a member PassKey; a member added to a started set is started
+func (set *PassKeySet) Add(pk *PassKey) *PassKeySet {
+	if pk == nil {
+		return set
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for i := range set.keys {
+		if set.keys[i] == pk {
+			return set
+		}
+	}
+	set.keys = append(set.keys, pk)
+	if set.ctx != nil {
+		set.run(pk)
+	}
+	return set
+}
+
+// Remove the member PassKey with the base32 secret and stop its roll timer;
+// the secret is matched in any case and reports false when no member had it
+func (set *PassKeySet) Remove(secret string) (removed bool) {
+	secret = strings.ToUpper(strings.TrimSpace(secret))
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for i := 0; i < len(set.keys); i++ {
+		if set.keys[i].Secret() == secret {
+			removed = true
+			if cancel, ok := set.cancel[set.keys[i]]; ok {
+				cancel()
+				delete(set.cancel, set.keys[i])
+			}
+			set.keys = append(set.keys[:i], set.keys[i+1:]...)
+			i--
+		}
+	}
+	return removed
+}
+
+// Len is the number of member PassKeys
+func (set *PassKeySet) Len() int {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	return len(set.keys)
+}
+
+// Start the interval roll timer of every member PassKey
+func (set *PassKeySet) Start(ctx context.Context) {
+
+	set.mu.Lock()
+	set.ctx = ctx
+	for i := range set.keys {
+		set.run(set.keys[i])
+	}
+	set.mu.Unlock()
+
+	<-ctx.Done()
+
+}
+
+// run starts pk under the set context; caller holds the lock
+func (set *PassKeySet) run(pk *PassKey) {
+	if _, ok := set.cancel[pk]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(set.ctx)
+	set.cancel[pk] = cancel
+	go pk.Start(ctx)
+}
+
+// Validate the token against every member PassKey; the outcome is
+// counted once by the set rather than as a failure of each other member
+func (set *PassKeySet) Validate(token uint32) bool {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	for i := range set.keys {
+		if set.keys[i].match(token) {
+			set.passed.Add(1)
+			return true
+		}
+	}
+	set.failed.Add(1)
+	return false
+}
+
+// ValidateString validates a token in its header string form against
+// every member PassKey; see PassKey.ValidateString
+func (set *PassKeySet) ValidateString(s string) bool {
+	token, ok := parseToken(s)
+	if !ok {
+		set.failed.Add(1)
+		return false
+	}
+	return set.Validate(token)
+}
+
+// Metrics provides a snapshot of the set validation counters with the
+// interval boundary of the newest member, which clients migrate to
+func (set *PassKeySet) Metrics() PassKeyMetrics {
+	var m PassKeyMetrics
+	set.mu.RLock()
+	if n := len(set.keys); n > 0 {
+		m = set.keys[n-1].Metrics()
+	}
+	set.mu.RUnlock()
+	m.Passed, m.Failed = set.passed.Load(), set.failed.Load()
+	return m
+}
+
+// MetricsHandler serves the set Metrics snapshot in the prometheus text
+// format; see PassKey.MetricsHandler
+func (set *PassKeySet) MetricsHandler() http.HandlerFunc { return metricsHandler(set.Metrics) }
+
+//
+// MIDDLEWARE
+//
+
+// IsValid middleware is restricted to tokens that are valid under
+// any member and set as token:{passkey} in the http header
+func (set *PassKeySet) IsValid(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if passkey := r.Header.Get(set.hKey); len(passkey) > 0 && set.ValidateString(passkey) {
+			if set.onAuth != nil {
+				set.onAuth(r)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
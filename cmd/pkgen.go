@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/base32"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/skip2/go-qrcode"
 	"github.com/zxdev/server/auth"
 )
 
@@ -27,42 +36,163 @@ import (
 
 	./pkgen
 	usage:
-	passkey {secret} {interval}
+	passkey [-qr] [-png file] [-watch] [-json] {secret} {interval}
 	secret   : LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI
 	interval : is n seconds (default 60s)
 
 	./pkgen LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI
 	323077921
+
+	# render the otpauth provisioning uri as a QR code on the terminal
+	# or as a png file for onboarding a new peer
+	./pkgen -qr LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI
+	./pkgen -png peer.png LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI
+
+	# watch the token roll to compare client and server; ctrl-c exits
+	./pkgen -watch LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI
+	323077921 (41s)
+	990123444 (60s)
+
+	# read the secret from stdin with - to keep it out of the shell
+	# history and process table; works with verify and interval too
+	vault read -field=secret secret/passkey | ./pkgen - 30
+
+	# machine readable output for scripting
+	./pkgen -json LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI
+	{"secret":"LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI","current":323077921,"previous":1200451129,"next":990123444,"interval":60}
+
+	# verify a token a client sent; exits non-zero when invalid
+	./pkgen verify LGU4NNOKNUXFD7RKJX3JEPHVY44AZ5CI 323077921
+	current
 */
 
 func main() {
 	var secret string
 	var interval int
 
-	switch len(os.Args) {
-	case 3:
-		interval, _ = strconv.Atoi(os.Args[2])
-		fallthrough
+	qr := flag.Bool("qr", false, "render the provisioning uri as a terminal QR code")
+	png := flag.String("png", "", "write the provisioning uri QR code to a png `file`")
+	watch := flag.Bool("watch", false, "print the token each time it rolls")
+	asJSON := flag.Bool("json", false, "print the secret, token set, and interval as json")
+	flag.Parse()
+	args := flag.Args()
+
+	// verify {secret} {token} {interval}
+	var verify string
+	if len(args) > 0 && args[0] == "verify" {
+		if len(args) < 3 {
+			fmt.Print("\nusage:\npasskey verify {secret} {token} {interval}\n\n")
+			os.Exit(2)
+		}
+		verify = args[2]
+		args = append(args[1:2], args[3:]...)
+	}
+
+	switch len(args) {
 	case 2:
-		secret = os.Args[1]
+		interval, _ = strconv.Atoi(args[1])
+		fallthrough
+	case 1:
+		secret = args[0]
 	default:
 		var b [20]byte
 		rand.Read(b[:])
-		fmt.Printf("\nusage:\npasskey {secret} {interval}\n secret   : %s\n interval : is n seconds (default 60s)\n\n",
+		fmt.Printf("\nusage:\npasskey [-qr] [-png file] [-watch] [-json] {secret} {interval}\n secret   : %s\n interval : is n seconds (default 60s)\n\n",
 			base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b[:]))
 		return
 	}
 
-	_, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
-	if err != nil || len(secret) != 32 {
-		fmt.Print("passkey:\n secret : requires a 32-character base32 encoded string value(A..Z,2..7)\n\n")
-		return
+	if secret == "-" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Fprintln(os.Stderr, "passkey:", err)
+			os.Exit(1)
+		}
+		secret = strings.TrimSpace(line)
 	}
 
-	pkc := auth.NewClient(secret)
+	pkc, err := auth.NewClient(secret)
+	if err != nil {
+		fmt.Fprint(os.Stderr, "passkey:\n secret : requires a base32 encoded string value(A..Z,2..7)\n\n")
+		os.Exit(1)
+	}
 	if interval > 0 {
 		pkc.Interval(interval)
 	}
+	pk := pkc.(*auth.PassKey) // full PassKey for uri and token set
+
+	if len(verify) > 0 {
+		token, err := strconv.ParseUint(verify, 10, 32)
+		if err == nil {
+			for i, window := range []string{"previous", "current", "next"} {
+				if pk.Tokens()[i] == uint32(token) {
+					fmt.Println(window)
+					return
+				}
+			}
+		}
+		fmt.Println("invalid")
+		os.Exit(1)
+	}
+
+	if *qr || len(*png) > 0 {
+		uri := pk.URI("pkgen", "passkey")
+		if len(*png) > 0 {
+			if err := qrcode.WriteFile(uri, qrcode.Medium, 256, *png); err != nil {
+				fmt.Fprintln(os.Stderr, "passkey:", err)
+				os.Exit(1)
+			}
+		}
+		if *qr {
+			q, err := qrcode.New(uri, qrcode.Medium)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "passkey:", err)
+				os.Exit(1)
+			}
+			fmt.Print(q.ToSmallString(false))
+			fmt.Println(uri)
+		}
+		return
+	}
+
+	if *watch {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		go pkc.Start(ctx)
+
+		period := pk.Metrics().Interval // effective period
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+
+		var last uint32
+		for {
+			if current := pkc.Current(); current != last {
+				// tokens are generated from time rounded to the interval
+				// so a window ends half an interval past the rounded time
+				now := time.Now()
+				remain := now.Round(period).Add(period / 2).Sub(now)
+				fmt.Printf("%d (%s)\n", current, remain.Round(time.Second))
+				last = current
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+		}
+	}
+
+	if *asJSON {
+		tokens := pk.Tokens()
+		json.NewEncoder(os.Stdout).Encode(struct {
+			Secret   string `json:"secret"`
+			Current  uint32 `json:"current"`
+			Previous uint32 `json:"previous"`
+			Next     uint32 `json:"next"`
+			Interval int    `json:"interval"`
+		}{pk.Secret(), tokens[1], tokens[0], tokens[2], int(pk.Metrics().Interval / time.Second)})
+		return
+	}
 
 	fmt.Println(pkc.Current())
 
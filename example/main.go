@@ -32,8 +32,9 @@ func main() {
 	switch {
 	case len(param.Secret) > 0:
 
-		pk := auth.NewPassKey(param.Secret)
-		if pk == nil {
+		pk, err := auth.NewPassKeyErr(param.Secret)
+		if err != nil {
+			log.Println("alert:", err)
 			pk = auth.NewPassKey(nil)
 			log.Println("tokens:", pk.Tokens())  // token set
 			log.Println("passkey:", pk.Secret()) // to stderr
@@ -44,7 +45,7 @@ func main() {
 
 		// demonstration for a client passkey configuration
 		// for authentication with a passkey remote server
-		pkc := auth.NewClient(pk.Secret())
+		pkc, _ := auth.NewClient(pk.Secret())
 		log.Println("demo-client:", pkc.Current())
 		log.Println("demo-tokens:", pk.Tokens())
 
@@ -53,6 +54,8 @@ func main() {
 		param.AuthKey = env.Dir(paths.Srv, "conf", param.AuthKey)
 		ak := auth.NewAuthKey(&param.AuthKey, router) // .Silent() .User("bob","I'mBobI'mBobI'mBob")
 		private(ak, router)
+		grace.Manager(ak.Refresh(time.Minute * 5)) // ak.Start; reload timer
+		defer ak.Close()                           // final save on exit
 
 	default:
 
@@ -4,11 +4,11 @@ go 1.20
 
 require (
 	github.com/go-chi/chi/v5 v5.0.12
+	github.com/pires/go-proxyproto v0.7.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/zxdev/env/v2 v2.0.1
 	golang.org/x/crypto v0.22.0
+	golang.org/x/net v0.24.0
 )
 
-require (
-	golang.org/x/net v0.24.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
-)
+require golang.org/x/text v0.14.0 // indirect
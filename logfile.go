@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// LogFile is an append-only log file writer that can be reopened so an
+// external logrotate can move the file and the writer continues with a
+// new file at the same path; eg. for an access log, the Logger ErrorLog,
+// or an auth.AuthKey Audit log
+//
+//	lf, err := server.OpenLogFile("/var/log/app/access.log")
+//	srv.Logger(log.New(lf, "", log.LstdFlags)).Logs(lf)
+//	kill -HUP $PID // after logrotate moves the file
+type LogFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenLogFile opens or creates path for appending
+func OpenLogFile(path string) (*LogFile, error) {
+	l := &LogFile{path: path}
+	if err := l.Reopen(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write appends p to the current file
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return 0, os.ErrClosed
+	}
+	return l.f.Write(p)
+}
+
+// Reopen the path and close the previous file; on failure the previous
+// file is kept so no log lines are lost
+func (l *LogFile) Reopen() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	prev := l.f
+	l.f = f
+	l.mu.Unlock()
+	if prev != nil {
+		return prev.Close()
+	}
+	return nil
+}
+
+// Close the file; later writes fail with os.ErrClosed
+func (l *LogFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Logs registers log files that ReopenLogs reopens; while the server is
+// running a SIGHUP calls ReopenLogs when any are registered
+func (srv *Server) Logs(files ...*LogFile) *Server {
+	srv.logs = append(srv.logs, files...)
+	return srv
+}
+
+// ReopenLogs reopens the registered log files after a log rotation
+func (srv *Server) ReopenLogs() error {
+	var errs []error
+	for i := range srv.logs {
+		errs = append(errs, srv.logs[i].Reopen())
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Println("alert: server: reopen logs", err)
+		return err
+	}
+	log.Println("server: logs reopened")
+	return nil
+}
+
+// hangup calls ReopenLogs on each SIGHUP until ctx is done
+func (srv *Server) hangup(ctx context.Context) {
+
+	if len(srv.logs) == 0 {
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				srv.ReopenLogs()
+			}
+		}
+	}()
+}
@@ -0,0 +1,442 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ctxKey is the middleware transport chain key type
+type ctxKey int
+
+const (
+	apiVersionKey ctxKey = iota // negotiated api version
+	requestIDKey                // request id
+)
+
+// vendor media type; eg. application/vnd.myapi.v2+json
+var vndVersion = regexp.MustCompile(`^application/vnd\.[\w.-]+\.(v\d+)(\+\w+)?$`)
+
+// AcceptVersion middleware negotiates the api version from a vendor media
+// type in the Accept header against the supported set; the first supported
+// version is the default for a missing or non-vendor Accept header
+//
+//	Accept: application/vnd.myapi.v2+json
+//	router.Use(server.AcceptVersion("v2", "v1"))
+func AcceptVersion(supported ...string) func(http.Handler) http.Handler {
+	var def string
+	if len(supported) > 0 {
+		def = supported[0]
+	}
+	return AcceptVersionDefault(def, supported...)
+}
+
+// AcceptVersionDefault middleware is AcceptVersion with an explicit default
+// version; unsupported vendor versions are rejected with 406 and the
+// negotiated version is available from GetAPIVersion
+func AcceptVersionDefault(def string, supported ...string) func(http.Handler) http.Handler {
+
+	ok := make(map[string]bool, len(supported))
+	for i := range supported {
+		ok[supported[i]] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			version, vendor := def, false
+			for _, media := range mediaTypes(r.Header.Values("Accept")) {
+				if m := vndVersion.FindStringSubmatch(media); m != nil {
+					if vendor = true; ok[m[1]] {
+						version, vendor = m[1], false
+						break
+					}
+				}
+			}
+
+			// only unsupported vendor versions were requested
+			if vendor || len(version) == 0 {
+				w.WriteHeader(http.StatusNotAcceptable) // 406
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey, version)))
+		})
+	}
+}
+
+// GetAPIVersion retrieves the negotiated api version from the r.Context
+// middleware transport chain; empty when AcceptVersion was not applied
+func GetAPIVersion(r *http.Request) string {
+	version, _ := r.Context().Value(apiVersionKey).(string)
+	return version
+}
+
+// RequestID middleware tags each request with the incoming X-Request-ID
+// header value, or a generated one, which is stored in the r.Context and
+// echoed back in the response header; see GetRequestID
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			var b [8]byte
+			rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// GetRequestID retrieves the request id from the r.Context middleware
+// transport chain; empty when RequestID was not applied
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// validRequestID limits a client supplied id to a short printable token
+// so that it can not be used to inject content into the logs
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 64 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RealIP middleware rewrites r.RemoteAddr to the client address from the
+// X-Forwarded-For or X-Real-IP headers only when the immediate peer is in
+// the trusted proxy set; the right-most untrusted X-Forwarded-For hop is the
+// client since any hop to its left can be spoofed by the client itself, and
+// the rewritten r.RemoteAddr keeps the ip:port form with a zero port
+//
+//	router.Use(server.RealIP([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}))
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for i := range trusted {
+			if trusted[i].Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			peer, err := netip.ParseAddrPort(r.RemoteAddr)
+			if err != nil || !isTrusted(peer.Addr()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var client netip.Addr
+			hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+				if err != nil {
+					break // a malformed hop ends the trusted chain
+				}
+				if client = addr.Unmap(); !isTrusted(addr) {
+					break
+				}
+			}
+			if !client.IsValid() {
+				if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+					client = addr.Unmap()
+				}
+			}
+
+			if client.IsValid() {
+				r.RemoteAddr = netip.AddrPortFrom(client, 0).String()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// mediaTypes splits Accept header values into bare media types in order
+func mediaTypes(values []string) (media []string) {
+	for i := range values {
+		for _, m := range strings.Split(values[i], ",") {
+			if n := strings.IndexByte(m, ';'); n >= 0 {
+				m = m[:n]
+			}
+			if m = strings.ToLower(strings.TrimSpace(m)); len(m) > 0 {
+				media = append(media, m)
+			}
+		}
+	}
+	return
+}
+
+// CORSOptions configures the CORS middleware; an AllowedOrigins entry
+// may be "*" or contain a single wildcard (eg. https://*.example.com)
+type CORSOptions struct {
+	AllowedOrigins   []string // default: *
+	AllowedMethods   []string // default: GET, HEAD, POST
+	AllowedHeaders   []string // default: echo Access-Control-Request-Headers
+	ExposedHeaders   []string
+	AllowCredentials bool // requires AllowedOrigins without "*"
+	MaxAge           int  // preflight cache seconds
+}
+
+// CORS middleware emits the cross-origin headers for allowed origins and
+// answers preflight OPTIONS requests with 204; apply before any auth
+// middleware so that preflight requests, which carry no credentials, are
+// not rejected; AllowCredentials is ignored with a "*" origin, including
+// the default, since any site could then make credentialed requests
+//
+//	router.Use(server.CORS(server.CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}))
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+
+	if len(opts.AllowedOrigins) == 0 {
+		opts.AllowedOrigins = []string{"*"}
+	}
+
+	// credentials for any origin would let every site act as the user
+	for _, o := range opts.AllowedOrigins {
+		if o == "*" && opts.AllowCredentials {
+			log.Println("alert: server: CORS AllowCredentials requires explicit AllowedOrigins; credentials disabled")
+			opts.AllowCredentials = false
+		}
+	}
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+
+	allowed := func(origin string) bool {
+		for _, o := range opts.AllowedOrigins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+			if n := strings.IndexByte(o, '*'); n >= 0 &&
+				len(origin) > len(o)-1 &&
+				strings.HasPrefix(origin, o[:n]) && strings.HasSuffix(origin, o[n+1:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// any origin without credentials can use the literal wildcard
+	wildcard := !opts.AllowCredentials && len(opts.AllowedOrigins) == 1 && opts.AllowedOrigins[0] == "*"
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// the response depends on the origin, including when it is
+			// refused, so a shared cache must not serve it to another one
+			h := w.Header()
+			if !wildcard {
+				h.Add("Vary", "Origin")
+			}
+
+			origin := r.Header.Get("Origin")
+			if len(origin) == 0 || !allowed(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if wildcard {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// preflight
+			if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+				h.Set("Access-Control-Allow-Methods", methods)
+				if len(headers) > 0 {
+					h.Set("Access-Control-Allow-Headers", headers)
+				} else if req := r.Header.Get("Access-Control-Request-Headers"); len(req) > 0 {
+					h.Set("Access-Control-Allow-Headers", req)
+				}
+				if opts.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(opts.MaxAge))
+				}
+				w.WriteHeader(http.StatusNoContent) // 204
+				return
+			}
+
+			if len(exposed) > 0 {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MaxBodyBytes middleware limits the request body to n bytes; a declared
+// Content-Length over the limit is rejected with 413 before the handler
+// runs, otherwise the body is wrapped with http.MaxBytesReader so a read
+// past the limit fails with *http.MaxBytesError for the handler to answer
+// with 413; apply globally with WithMaxBodyBytes or per route group
+//
+//	router.With(server.MaxBodyBytes(1 << 20)).Post("/import", handler)
+func MaxBodyBytes(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if r.ContentLength > n {
+				w.Header().Set("Connection", "close")
+				writeError(w, http.StatusRequestEntityTooLarge, nil) // 413
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout middleware gives the handler a context with a d deadline and
+// responds with a json 504 when the handler has not started its response
+// by then; later writes from the handler fail with http.ErrHandlerTimeout
+// so it should watch r.Context() and return, while a response already
+// started is left to finish within the server WriteTimeout
+//
+// keep d below the server WriteTimeout since the connection is closed
+// once the WriteTimeout expires and the client would get no response at
+// all; the default WriteTimeout is 3x ReadTimeout, eg. 30s
+//
+//	router.With(server.Timeout(time.Second * 5)).Get("/report", handler)
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, h: make(http.Header), ctx: ctx}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+				tw.mu.Lock()
+				if !tw.expired() {
+					tw.start(http.StatusOK) // headers of a handler that never wrote
+					tw.mu.Unlock()
+					return
+				}
+				tw.mu.Unlock()
+			case p := <-panicked:
+				panic(p) // surface on the serving goroutine
+			case <-ctx.Done():
+			}
+
+			tw.mu.Lock()
+			if !tw.wrote {
+				tw.timedOut = true
+				if ctx.Err() == context.DeadlineExceeded {
+					writeError(w, http.StatusGatewayTimeout, nil) // 504
+				}
+				tw.mu.Unlock()
+				return
+			}
+			tw.mu.Unlock()
+
+			// a started response can not be replaced; let it finish
+			select {
+			case <-done:
+			case p := <-panicked:
+				panic(p)
+			}
+		})
+	}
+}
+
+// timeoutWriter serializes the handler writes with the Timeout response;
+// the handler headers are kept apart until the response starts so the
+// 504 headers never race with the handler
+type timeoutWriter struct {
+	mu       sync.Mutex
+	w        http.ResponseWriter
+	h        http.Header     // handler headers
+	ctx      context.Context // handler context with the Timeout deadline
+	wrote    bool            // response started
+	timedOut bool            // Timeout responded; handler writes are rejected
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+// expired reports whether handler writes are rejected; a handler that
+// writes as soon as its context is done would otherwise beat the 504
+// that Timeout is about to send; the caller holds the lock
+func (tw *timeoutWriter) expired() bool {
+	return tw.timedOut || !tw.wrote && tw.ctx.Err() != nil
+}
+
+// start copies the handler headers and writes the status; the caller
+// holds the lock
+func (tw *timeoutWriter) start(code int) {
+	if !tw.wrote {
+		tw.wrote = true
+		for k, v := range tw.h {
+			tw.w.Header()[k] = v
+		}
+		tw.w.WriteHeader(code)
+	}
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.expired() {
+		tw.start(code)
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.start(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+// Flush passes through to the underlying writer for streaming handlers
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if f, ok := tw.w.(http.Flusher); ok && !tw.expired() {
+		tw.start(http.StatusOK)
+		f.Flush()
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutWriteAfterDone(t *testing.T) {
+
+	h := Timeout(time.Millisecond * 10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("late")); err != http.ErrHandlerTimeout {
+			t.Errorf("write err = %v; want %v", err, http.ErrHandlerTimeout)
+		}
+	}))
+
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusGatewayTimeout {
+			t.Fatalf("run %d: status = %d; want %d", i, w.Code, http.StatusGatewayTimeout)
+		}
+	}
+}
+
+func TestTimeoutWriterExpiredContext(t *testing.T) {
+
+	// the deadline passed but Timeout has not taken the lock yet
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	tw := &timeoutWriter{w: w, h: make(http.Header), ctx: ctx}
+	tw.WriteHeader(http.StatusOK)
+	if _, err := tw.Write([]byte("late")); err != http.ErrHandlerTimeout {
+		t.Fatalf("write err = %v; want %v", err, http.ErrHandlerTimeout)
+	}
+	if tw.wrote || w.Body.Len() > 0 {
+		t.Fatal("response started after the deadline")
+	}
+}
+
+func TestCORSVaryOrigin(t *testing.T) {
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		opts   CORSOptions
+		origin string
+		vary   bool
+	}{
+		{CORSOptions{}, "https://a.example.com", false},
+		{CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}, "https://a.example.com", true},
+		{CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}, "https://evil.test", true},
+		{CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}, "", true},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if len(tc.origin) > 0 {
+			r.Header.Set("Origin", tc.origin)
+		}
+		CORS(tc.opts)(ok).ServeHTTP(w, r)
+		if vary := w.Header().Get("Vary") == "Origin"; vary != tc.vary {
+			t.Errorf("%v origin %q: Vary Origin = %v; want %v", tc.opts.AllowedOrigins, tc.origin, vary, tc.vary)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Option configures a *Server built by New
+type Option func(*Server)
+
+// New is a *Server constructor for the common configurations that would
+// otherwise assemble an *http.Server by hand; the options are applied in
+// order and then Configure applies its defaults, while Configure remains
+// for full control of the *http.Server
+//
+//	srv := server.New(server.WithHandler(router), server.WithPort(8080))
+//	grace.Manager(srv)
+func New(opts ...Option) *Server {
+
+	srv := &Server{Host: "localhost", opt: new(http.Server)}
+	for i := range opts {
+		opts[i](srv)
+	}
+
+	if srv.port > 0 && isLocal(srv.Host) {
+		host := srv.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		srv.Host = net.JoinHostPort(host, strconv.Itoa(srv.port))
+	}
+
+	return srv.Configure(srv.opt)
+}
+
+// WithHandler sets the http.Handler; {default:404}
+func WithHandler(h http.Handler) Option {
+	return func(srv *Server) { srv.opt.Handler = h }
+}
+
+// WithHost sets the Host as localhost, an IP, a FQDN[,FQDN...], or a
+// unix:/path/to.sock; {default:localhost}
+func WithHost(host string) Option {
+	return func(srv *Server) { srv.Host = host }
+}
+
+// WithPort sets the listener port of a localhost or IP Host; {default:1455}
+func WithPort(port int) Option {
+	return func(srv *Server) { srv.port = port }
+}
+
+// WithReadTimeout sets the http.Server ReadTimeout; {default:10s}
+func WithReadTimeout(d time.Duration) Option {
+	return func(srv *Server) { srv.opt.ReadTimeout = d }
+}
+
+// WithReadHeaderTimeout sets the http.Server ReadHeaderTimeout; {default:ReadTimeout}
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(srv *Server) { srv.opt.ReadHeaderTimeout = d }
+}
+
+// WithWriteTimeout sets the http.Server WriteTimeout; {default:3x ReadTimeout}
+func WithWriteTimeout(d time.Duration) Option {
+	return func(srv *Server) { srv.opt.WriteTimeout = d }
+}
+
+// WithTLS adds the https listener on addr alongside a localhost or IP
+// Host using the certificate and key files; see Server.TLSAddr
+//
+//	server.WithTLS(":8443", "/etc/tls/cert.pem", "/etc/tls/key.pem")
+func WithTLS(addr, certFile, keyFile string) Option {
+	return func(srv *Server) { srv.TLSAddr, srv.CertFile, srv.KeyFile = addr, certFile, keyFile }
+}
+
+// WithDrain sets the graceful shutdown timeout and callback; see Drain
+func WithDrain(timeout time.Duration, fn func()) Option {
+	return func(srv *Server) { srv.Drain(timeout, fn) }
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zxdev/server/auth"
+)
+
+// admin is an auth.Authentication with an admin only middleware
+type admin interface {
+	IsAdmin(http.Handler) http.Handler
+}
+
+// WithPprof adds the /debug/pprof routes protected by the supplied
+// auth.Authentication as described by Pprof; {default:off}
+//
+//	ak := new(auth.AuthKey).Configure(&path)
+//	router := server.Public(server.Heartbeat, nil, nil, server.WithPprof(ak))
+func WithPprof(a auth.Authentication) RouteOption {
+	return func(rt *routes) { rt.pprof = a }
+}
+
+// Pprof mounts the net/http/pprof handlers under /debug/pprof on router
+// behind the IsAdmin middleware of a when it has one (eg. auth.AuthKey)
+// otherwise IsValid; profiles expose internals so the routes are never
+// mounted without an auth.Authentication
+//
+// the cpu profile and trace ?seconds= (default 30 and 1) are capped below
+// the server WriteTimeout, which would otherwise end the response before
+// the profile is written; raise the WriteTimeout for longer profiles
+//
+//	server.Pprof(router, ak)
+//	curl -H token:$KEY -o heap.pb.gz https://example.com/debug/pprof/heap
+//	go tool pprof -http=: heap.pb.gz
+func Pprof(router chi.Router, a auth.Authentication) {
+
+	if a == nil {
+		log.Println("alert: pprof requires an auth.Authentication; not mounted")
+		return
+	}
+
+	log.Println("server: add pprof routes")
+
+	router.Route("/debug/pprof", func(r chi.Router) {
+		if m, ok := a.(admin); ok {
+			r.Use(m.IsAdmin)
+		} else {
+			r.Use(a.IsValid)
+		}
+		r.Get("/", pprof.Index)
+		r.Get("/cmdline", pprof.Cmdline)
+		r.Get("/profile", capSeconds(30, pprof.Profile))
+		r.HandleFunc("/symbol", pprof.Symbol) // GET and POST
+		r.Get("/trace", capSeconds(1, pprof.Trace))
+		r.Get("/{profile}", func(w http.ResponseWriter, req *http.Request) {
+			pprof.Handler(chi.URLParam(req, "profile")).ServeHTTP(w, req)
+		})
+	})
+}
+
+// capSeconds holds the ?seconds= collection time {default:def} below the
+// server WriteTimeout with a margin to write the result
+func capSeconds(def int, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		s, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+		if !ok || s.WriteTimeout <= 0 {
+			next(w, r)
+			return
+		}
+
+		sec, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil || sec <= 0 {
+			sec = def
+		}
+
+		margin := s.WriteTimeout / 10
+		if margin < time.Second {
+			margin = time.Second
+		}
+		if limit := int((s.WriteTimeout - margin) / time.Second); sec > limit {
+			if limit < 1 {
+				limit = 1
+			}
+			log.Printf("server: pprof %s capped at %ds by the WriteTimeout", r.URL.Path, limit)
+			sec = limit
+		}
+
+		q := r.URL.Query()
+		q.Set("seconds", strconv.Itoa(sec))
+		r.URL.RawQuery = q.Encode()
+		next(w, r)
+	}
+}
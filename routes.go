@@ -1,66 +1,709 @@
 package server
 
 import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"mime"
 	"net/http"
+	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/zxdev/server/auth"
+)
+
+// started is the process start time used for uptime reporting
+var started = time.Now()
+
+// build metadata reported by /version; set with linker flags and when
+// unset the vcs stamp from the go build info is used
+//
+//	go build -ldflags "-X github.com/zxdev/server.Version=v1.2.0 \
+//	 -X github.com/zxdev/server.Commit=$(git rev-parse --short HEAD) \
+//	 -X github.com/zxdev/server.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   string
+	Commit    string
+	BuildTime string
 )
 
 // Heartbeat; default response
 func Heartbeat() string { return "alive" }
 
+// routes holds the optional Public and Routes route settings
+type routes struct {
+	heartbeat func() string            // heartbeat status; nil uses Heartbeat
+	hbOn      bool                     // /hb heartbeat endpoint
+	hbKey     string                   // /hb response header key; heartbeat
+	hbValue   func(string, int) string // /hb header value encoding
+	epOn      bool                     // endpoint listing
+	dlPath    *string                  // download directory
+	docPath   *string                  // documentation directory
+	healthz   bool                     // json heartbeat endpoint
+	version   string                   // build version reported by healthz
+	ready     func() bool              // readiness probe; nil disables /readyz
+	docExt    []string                 // allowed doc extensions in resolution order
+	docSave   bool                     // doc attachment disposition
+	catalog   bool                     // /dl download listing
+	catAuth   auth.Authentication      // download listing protection; nil public
+	upAuth    auth.Authentication      // upload protection; nil disables upload
+	upMax     int64                    // upload size limit
+	static    []static                 // fs.FS mounts
+	epAuth    auth.Authentication      // endpoint listing protection
+	epOff     bool                     // omit endpoint listing
+	pprof     auth.Authentication      // pprof protection; nil disables /debug/pprof
+	verOn     bool                     // build metadata endpoint
+	check     func() error             // health check; nil is always healthy
+	notFound  http.HandlerFunc         // unmatched routes; default json 404
+	maxBody   int64                    // request body limit; 0 unlimited
+}
+
+// RouteOption configures optional Public and Routes route behavior
+type RouteOption func(*routes)
+
+// WithHealthz adds /healthz which returns a json body with the heartbeat
+// status, uptime, go version, and the provided build version
+func WithHealthz(version string) RouteOption {
+	return func(rt *routes) { rt.healthz = true; rt.version = version }
+}
+
+// WithVersion adds /version which returns a cacheable json body with the
+// build metadata from the Version, Commit, and BuildTime linker flags
+//
+//	{"version":"v1.2.0","commit":"a1b2c3d","buildTime":"2024-05-01T12:00:00Z","goVersion":"go1.22.2"}
+func WithVersion() RouteOption {
+	return func(rt *routes) { rt.verOn = true }
+}
+
+// WithHealthCheck sets a check that /hb and /healthz consult on each
+// request; an error responds 503 with an unhealthy status (eg. a required
+// dependency is down) while the heartbeat string is used when healthy
+//
+//	server.WithHealthCheck(func() error { return db.Ping() })
+func WithHealthCheck(check func() error) RouteOption {
+	return func(rt *routes) { rt.check = check }
+}
+
+// WithNotFound replaces the default json 404 response for unmatched routes
+func WithNotFound(h http.HandlerFunc) RouteOption {
+	return func(rt *routes) { rt.notFound = h }
+}
+
+// WithReadyz adds /readyz which responds 503 until ready reports true and
+// 200 afterward while /hb remains a pure liveness check
+//
+//	router := server.Public(server.Heartbeat, nil, nil, server.WithReadyz(srv.Ready))
+//	srv.SetReady(true) // after bootstrap
+func WithReadyz(ready func() bool) RouteOption {
+	return func(rt *routes) { rt.ready = ready }
+}
+
+// WithDocExt sets the allowed /doc/{file} extensions; a bare name resolves
+// to the first existing file trying each extension in the order given and
+// the Content-Type follows the served extension {default:.pdf}
+//
+//	server.WithDocExt(".pdf", ".html", ".md", ".txt")
+func WithDocExt(ext ...string) RouteOption {
+	return func(rt *routes) { rt.docExt = ext }
+}
+
+// WithDocAttachment serves /doc/{file} with an attachment disposition so
+// browsers download rather than render; ?download=1 forces attachment per
+// request {default:inline}
+func WithDocAttachment() RouteOption {
+	return func(rt *routes) { rt.docSave = !rt.docSave }
+}
+
+// WithCatalog adds /dl which lists the dlPath downloads as json, protected
+// by the IsValid middleware of a or public like /dl/{file} when a is nil;
+// see Catalog {default:off}
+//
+//	router := server.Public(server.Heartbeat, &dlPath, nil, server.WithCatalog(nil))
+func WithCatalog(a auth.Authentication) RouteOption {
+	return func(rt *routes) { rt.catalog, rt.catAuth = true, a }
+}
+
+// WithUpload adds POST /dl/{file} behind the IsAdmin middleware of a when
+// it has one (eg. auth.AuthKey) otherwise IsValid to publish files to the
+// dlPath of at most limit bytes; see Upload {default:off}
+//
+//	router := server.Public(server.Heartbeat, &dlPath, nil, server.WithUpload(ak, 100<<20))
+//	curl -H token:$KEY --data-binary @app.tar.gz https://example.com/dl/app.tar.gz?overwrite=1
+func WithUpload(a auth.Authentication, limit int64) RouteOption {
+	return func(rt *routes) { rt.upAuth, rt.upMax = a, limit }
+}
+
+// WithEndpointAuth protects /x/endpoint with the IsValid middleware of
+// the supplied auth.Authentication so the route map is not public
+//
+//	ak := new(auth.AuthKey).Configure(&path)
+//	router := server.Public(server.Heartbeat, nil, nil, server.WithEndpointAuth(ak))
+//	ak.Routes(router)
+func WithEndpointAuth(a auth.Authentication) RouteOption {
+	return func(rt *routes) { rt.epOn, rt.epAuth = true, a }
+}
+
+// WithHeartbeat adds /hb which reports the heartbeat status in the
+// heartbeat response header; a nil heartbeat uses Heartbeat
+func WithHeartbeat(heartbeat func() string) RouteOption {
+	return func(rt *routes) { rt.hbOn, rt.heartbeat = true, heartbeat }
+}
+
+// WithHeartbeatHeader sets the /hb response header key and an optional
+// value encoding of the heartbeat status and http status code so that a
+// load balancer health check can match on them {default:heartbeat}
+//
+//	server.WithHeartbeatHeader("X-Health", func(status string, code int) string {
+//		if code == http.StatusOK {
+//			return "UP"
+//		}
+//		return "DOWN"
+//	})
+func WithHeartbeatHeader(key string, value func(status string, code int) string) RouteOption {
+	return func(rt *routes) { rt.hbKey, rt.hbValue = key, value }
+}
+
+// WithEndpoints adds /x/endpoint which lists the registered routes; on by
+// default with Public
+func WithEndpoints() RouteOption {
+	return func(rt *routes) { rt.epOn = true }
+}
+
+// WithDownloads adds /dl/{file} which serves files from path
+func WithDownloads(path string) RouteOption {
+	return func(rt *routes) { rt.dlPath = &path }
+}
+
+// WithDocs adds /doc/{file} which serves files from path limited to the
+// WithDocExt extensions
+func WithDocs(path string) RouteOption {
+	return func(rt *routes) { rt.docPath = &path }
+}
+
+// WithMaxBodyBytes limits every request body on the router; see
+// MaxBodyBytes {default:unlimited}
+func WithMaxBodyBytes(n int64) RouteOption {
+	return func(rt *routes) { rt.maxBody = n }
+}
+
+// WithoutEndpoint omits /x/endpoint entirely; eg. for production
+func WithoutEndpoint() RouteOption {
+	return func(rt *routes) { rt.epOff = true }
+}
+
 // Public represents a common set of routes for use with the chi mux router
 // [root, heartbeat, endpoints, download, documentation] and returns the
-// chi Router interface
-func Public(heartbeat func() string, dlPath, docPath *string) *chi.Mux {
+// chi Router interface; opts enable the optional routes
+//
+// Public is the composition of the json 404/405 responses, a 400 root, and
+// Routes with WithHeartbeat, WithEndpoints, WithDownloads, and WithDocs set
+// from its arguments; use Routes on a chi.NewMux to pick exactly which
+// standard routes are registered
+func Public(heartbeat func() string, dlPath, docPath *string, opts ...RouteOption) *chi.Mux {
+
+	rt := routes{heartbeat: heartbeat, hbOn: heartbeat != nil, epOn: true, dlPath: dlPath, docPath: docPath}
+	for i := range opts {
+		opts[i](&rt)
+	}
 
 	router := chi.NewMux()
 
 	log.Println("server: add public routes")
 
+	if rt.maxBody > 0 {
+		router.Use(MaxBodyBytes(rt.maxBody))
+	}
+
+	// method not allowed; 405 json with the Allow header for probing
+	// clients, and OPTIONS answers 204 with the Allow header
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		allow := allowed(router, r)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent) // 204
+			return
+		}
+		writeError(w, http.StatusMethodNotAllowed, allow) // 405
+	})
+
+	// not found; json 404 unless replaced with WithNotFound
+	if rt.notFound == nil {
+		rt.notFound = func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound, nil) // 404
+		}
+	}
+	router.NotFound(rt.notFound)
+
 	// root; go away
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest) // 400
 	})
 
+	rt.register(router)
+
+	return router
+}
+
+// Routes registers only the standard routes enabled by opts onto router
+// so they can be composed with application routes; WithMaxBodyBytes must
+// be applied before router has any routes and WithNotFound is ignored
+//
+//	router := chi.NewMux()
+//	server.Routes(router, server.WithHeartbeat(server.Heartbeat), server.WithVersion())
+//	router.Get("/api/thing", thing)
+func Routes(router chi.Router, opts ...RouteOption) {
+
+	var rt routes
+	for i := range opts {
+		opts[i](&rt)
+	}
+
+	if rt.maxBody > 0 {
+		router.Use(MaxBodyBytes(rt.maxBody))
+	}
+
+	rt.register(router)
+}
+
+// register the enabled standard routes on router
+func (rt *routes) register(router chi.Router) {
+
+	if len(rt.docExt) == 0 {
+		rt.docExt = []string{".pdf"}
+	}
+
+	// health; the heartbeat status or unhealthy with 503
+	health := func() (string, int, error) {
+		if rt.check != nil {
+			if err := rt.check(); err != nil {
+				return "unhealthy", http.StatusServiceUnavailable, err
+			}
+		}
+		if rt.heartbeat != nil {
+			return rt.heartbeat(), http.StatusOK, nil
+		}
+		return Heartbeat(), http.StatusOK, nil
+	}
+
 	// heartbeat; header
-	if heartbeat != nil {
+	if len(rt.hbKey) == 0 {
+		rt.hbKey = "heartbeat"
+	}
+	if rt.hbOn || rt.check != nil {
 		router.Get("/hb", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("heartbeat", heartbeat())
+			status, code, _ := health()
+			if rt.hbValue != nil {
+				status = rt.hbValue(status, code)
+			}
+			w.Header().Set(rt.hbKey, status)
+			w.WriteHeader(code) // 200 or 503
+		})
+	}
+
+	// healthz; json heartbeat with build metadata
+	if rt.healthz {
+		router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			status, code, err := health()
+			var reason string
+			if err != nil {
+				reason = err.Error()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code) // 200 or 503
+			json.NewEncoder(w).Encode(struct {
+				Status  string `json:"status"`
+				Error   string `json:"error,omitempty"`
+				Uptime  string `json:"uptime"`
+				Go      string `json:"go"`
+				Version string `json:"version,omitempty"`
+			}{status, reason, time.Since(started).Round(time.Second).String(), runtime.Version(), rt.version})
+		})
+	}
+
+	// version; build metadata, fixed for the life of the process
+	if rt.verOn {
+		body, _ := json.Marshal(buildInfo())
+		etag := fmt.Sprintf(`"%x"`, sha1.Sum(body))
+		router.Get("/version", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified) // 304
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK) // 200
+			w.Write(append(body, '\n'))
+		})
+	}
+
+	// readyz; readiness, separate from heartbeat liveness
+	if rt.ready != nil {
+		router.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			if !rt.ready() {
+				w.WriteHeader(http.StatusServiceUnavailable) // 503
+				return
+			}
 			w.WriteHeader(http.StatusOK) // 200
 		})
 	}
 
-	// endpoint; list all available registered routes
-	router.Get("/x/endpoint", func(w http.ResponseWriter, req *http.Request) {
+	// endpoint; list all available registered routes, served inline
+	// or as a routes.txt attachment with ?download=1, and as json with
+	// ?format=json or Accept: application/json
+	endpoint := func(w http.ResponseWriter, req *http.Request) {
+
+		type endpoint struct {
+			Method string `json:"method"`
+			Route  string `json:"route"`
+		}
+
+		list := make([]endpoint, 0, 16)
 		chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
-			route = strings.Replace(route, "/*/", "/", -1)
-			fmt.Fprintf(w, "%s %s\n", method, route)
+			list = append(list, endpoint{method, strings.Replace(route, "/*/", "/", -1)})
 			return nil
 		})
-	})
+
+		if req.URL.Query().Get("format") == "json" ||
+			strings.Contains(req.Header.Get("Accept"), "application/json") {
+			if req.URL.Query().Get("download") == "1" {
+				w.Header().Set("Content-Disposition", "attachment; filename=routes.json")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+
+		if req.URL.Query().Get("download") == "1" {
+			w.Header().Set("Content-Disposition", "attachment; filename=routes.txt")
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for i := range list {
+			fmt.Fprintf(w, "%s %s\n", list[i].Method, list[i].Route)
+		}
+	}
+
+	switch { // public, protected, or omitted
+	case !rt.epOn || rt.epOff:
+	case rt.epAuth != nil:
+		router.With(rt.epAuth.IsValid).Get("/x/endpoint", endpoint)
+	default:
+		router.Get("/x/endpoint", endpoint)
+	}
 
 	// download; optional public download
-	if dlPath != nil && len(*dlPath) > 0 { // 200 or 404
+	if rt.dlPath != nil && len(*rt.dlPath) > 0 { // 200 or 404
 		router.Get("/dl/{file}", func(w http.ResponseWriter, req *http.Request) {
-			http.ServeFile(w, req, filepath.Join(*dlPath, chi.URLParam(req, "file")))
+			target, ok := within(*rt.dlPath, chi.URLParam(req, "file"))
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest) // 400
+				return
+			}
+			if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() {
+				// ServeFile honors If-None-Match and If-Range against this
+				// ETag so clients can cache and resume large downloads
+				w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+			}
+			http.ServeFile(w, req, target)
 		})
+
+		// upload; optional, always behind auth
+		if rt.upAuth != nil {
+			if m, ok := rt.upAuth.(admin); ok {
+				router.With(m.IsAdmin).Post("/dl/{file}", Upload(*rt.dlPath, rt.upMax))
+			} else {
+				router.With(rt.upAuth.IsValid).Post("/dl/{file}", Upload(*rt.dlPath, rt.upMax))
+			}
+		}
+
+		switch { // optional listing; public or protected
+		case !rt.catalog:
+		case rt.catAuth != nil:
+			router.With(rt.catAuth.IsValid).Get("/dl", Catalog(*rt.dlPath))
+		default:
+			router.Get("/dl", Catalog(*rt.dlPath))
+		}
 	}
 
-	// documentation; optional, pdf enforced public download
-	if docPath != nil && len(*docPath) > 0 { // 200 or 404
+	// documentation; optional, extension enforced public download
+	if rt.docPath != nil && len(*rt.docPath) > 0 { // 200 or 404
 		router.Get("/doc/{file}", func(w http.ResponseWriter, req *http.Request) {
-			target := filepath.Join(*docPath, chi.URLParam(req, "file"))
-			if !strings.HasSuffix(target, ".pdf") {
-				target += ".pdf"
+			target, ok := within(*rt.docPath, chi.URLParam(req, "file"))
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest) // 400
+				return
+			}
+			target = docFile(target, rt.docExt)
+			if ct := mime.TypeByExtension(filepath.Ext(target)); len(ct) > 0 {
+				w.Header().Set("Content-Type", ct)
+			} else if ct, ok := docTypes[filepath.Ext(target)]; ok {
+				w.Header().Set("Content-Type", ct)
+			}
+			if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() {
+				// inline renders in the browser; attachment downloads
+				disposition := "inline"
+				if rt.docSave || req.URL.Query().Get("download") == "1" {
+					disposition = "attachment"
+				}
+				w.Header().Set("Content-Disposition",
+					mime.FormatMediaType(disposition, map[string]string{"filename": filepath.Base(target)}))
 			}
 			http.ServeFile(w, req, target)
 		})
 	}
 
-	return router
+	// pprof; optional, always behind auth
+	if rt.pprof != nil {
+		Pprof(router, rt.pprof)
+	}
+
+	// static; optional fs.FS mounts
+	for i := range rt.static {
+		if rt.static[i].spa {
+			mount(router, rt.static[i].prefix, SPA(rt.static[i].fsys))
+			continue
+		}
+		mount(router, rt.static[i].prefix, Static(rt.static[i].fsys))
+	}
+}
+
+// writeError writes the json error body used for router level errors
+//
+//	{"status":405,"error":"method not allowed","allow":["GET","OPTIONS"]}
+func writeError(w http.ResponseWriter, status int, allow []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Status int      `json:"status"`
+		Error  string   `json:"error"`
+		Allow  []string `json:"allow,omitempty"`
+	}{status, strings.ToLower(http.StatusText(status)), allow})
+}
+
+// allowed lists the methods that have a route matching the request path
+func allowed(router *chi.Mux, r *http.Request) (allow []string) {
+
+	path := r.URL.RawPath
+	if len(path) == 0 {
+		path = r.URL.Path
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost,
+		http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if router.Match(chi.NewRouteContext(), method, path) {
+			allow = append(allow, method)
+		}
+	}
+	if len(allow) > 0 { // a route or MethodNotAllowed answers OPTIONS
+		allow = append(allow, http.MethodOptions)
+	}
+
+	return
+}
+
+// buildInfo resolves the build metadata from the linker flags with
+// a fallback to the module version and vcs stamp of the binary
+func buildInfo() (info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}) {
+
+	info.Version, info.Commit, info.BuildTime = Version, Commit, BuildTime
+	info.GoVersion = runtime.Version()
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if len(info.Version) == 0 && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && len(info.Commit) == 0:
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && len(info.BuildTime) == 0:
+				info.BuildTime = s.Value
+			}
+		}
+	}
+
+	return
+}
+
+// within joins a single file name to root and reports false when the name
+// is absolute, contains a separator or .. element, or escapes root
+func within(root, name string) (string, bool) {
+
+	if len(name) == 0 || name == "." || name == ".." ||
+		filepath.IsAbs(name) || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+
+	target := filepath.Join(root, name)
+	rel, err := filepath.Rel(filepath.Clean(root), target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return target, true
+}
+
+// Catalog lists the regular files in dir as json for use at /dl or on a
+// private router; hidden dotfiles and directories are excluded
+//
+//	[{"name":"app.tar.gz","size":1048576,"modtime":"2024-05-01T12:00:00Z"}]
+func Catalog(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		type file struct {
+			Name    string    `json:"name"`
+			Size    int64     `json:"size"`
+			ModTime time.Time `json:"modtime"`
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, nil) // 500
+			return
+		}
+
+		list := make([]file, 0, len(entries))
+		for i := range entries {
+			if strings.HasPrefix(entries[i].Name(), ".") || !entries[i].Type().IsRegular() {
+				continue
+			}
+			if info, err := entries[i].Info(); err == nil {
+				list = append(list, file{info.Name(), info.Size(), info.ModTime().UTC().Truncate(time.Second)})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// Upload streams the request body to the {file} url parameter in dir
+// through a temporary file so a partial upload is never served; the body
+// is limited to limit bytes (413) when limit > 0, an existing file is only
+// replaced with ?overwrite=1 (409), and the name must be a plain file name
+// that is not hidden (400); responds 201, or 200 when replaced, with the
+// stored size
+//
+//	{"status":201,"file":"app.tar.gz","size":1048576}
+func Upload(dir string, limit int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		name := chi.URLParam(r, "file")
+		target, ok := within(dir, name)
+		if !ok || strings.HasPrefix(name, ".") {
+			writeError(w, http.StatusBadRequest, nil) // 400
+			return
+		}
+
+		overwrite := r.URL.Query().Get("overwrite") == "1"
+		if _, err := os.Stat(target); err == nil && !overwrite {
+			writeError(w, http.StatusConflict, nil) // 409
+			return
+		}
+
+		if limit > 0 {
+			if r.ContentLength > limit {
+				writeError(w, http.StatusRequestEntityTooLarge, nil) // 413
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		tmp, err := os.CreateTemp(dir, ".upload-*")
+		if err != nil {
+			log.Println("server: upload", err)
+			writeError(w, http.StatusInternalServerError, nil) // 500
+			return
+		}
+		defer os.Remove(tmp.Name()) // gone once linked or renamed
+
+		size, err := io.Copy(tmp, r.Body)
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, nil) // 413
+				return
+			}
+			log.Println("server: upload", err)
+			writeError(w, http.StatusInternalServerError, nil) // 500
+			return
+		}
+		os.Chmod(tmp.Name(), 0644) // CreateTemp is 0600
+
+		// link refuses an existing target so a concurrent upload of the
+		// same name can not be clobbered without overwrite
+		status := http.StatusCreated
+		if overwrite {
+			if _, err := os.Stat(target); err == nil {
+				status = http.StatusOK
+			}
+			err = os.Rename(tmp.Name(), target)
+		} else {
+			err = os.Link(tmp.Name(), target)
+		}
+		switch {
+		case errors.Is(err, fs.ErrExist):
+			writeError(w, http.StatusConflict, nil) // 409
+			return
+		case err != nil:
+			log.Println("server: upload", err)
+			writeError(w, http.StatusInternalServerError, nil) // 500
+			return
+		}
+
+		log.Printf("server: upload %s %d bytes", name, size)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Status int    `json:"status"`
+			File   string `json:"file"`
+			Size   int64  `json:"size"`
+		}{status, name, size})
+	}
+}
+
+// docTypes are the doc Content-Types that the mime package may not know
+var docTypes = map[string]string{
+	".md":  "text/markdown; charset=utf-8",
+	".txt": "text/plain; charset=utf-8",
+}
+
+// docFile resolves target against the allowed extensions; a target with an
+// allowed extension is used as is otherwise the first existing target+ext
+// in order wins, falling back to the first extension for a 404
+func docFile(target string, ext []string) string {
+
+	for i := range ext {
+		if strings.HasSuffix(target, ext[i]) {
+			return target
+		}
+	}
+
+	for i := range ext {
+		if _, err := os.Stat(target + ext[i]); err == nil {
+			return target + ext[i]
+		}
+	}
+
+	return target + ext[0]
 }
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDownloadRangeAndETag(t *testing.T) {
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.bin"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(Public(Heartbeat, &dir, nil))
+	defer ts.Close()
+
+	get := func(header ...string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/dl/data.bin", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get()
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || len(etag) == 0 {
+		t.Fatalf("GET = %d etag %q; want 200 with an ETag", resp.StatusCode, etag)
+	}
+
+	// partial content
+	resp = get("Range", "bytes=2-5")
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(b) != "2345" {
+		t.Fatalf("Range = %d %q; want 206 \"2345\"", resp.StatusCode, b)
+	}
+
+	// resume only while the file is unchanged
+	resp = get("Range", "bytes=8-", "If-Range", etag)
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(b) != "89" {
+		t.Fatalf("If-Range = %d %q; want 206 \"89\"", resp.StatusCode, b)
+	}
+
+	// cached copy is current
+	resp = get("If-None-Match", etag)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("If-None-Match = %d; want 304", resp.StatusCode)
+	}
+
+	resp = get("If-None-Match", `"stale"`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("If-None-Match stale = %d; want 200", resp.StatusCode)
+	}
+}
+
+func TestStaticDirectoryRedirect(t *testing.T) {
+
+	fsys := fstest.MapFS{"docs/index.html": {Data: []byte("docs")}}
+	ts := httptest.NewServer(Public(Heartbeat, nil, nil, WithStatic("/ui", fsys)))
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(ts.URL + "/ui/docs?v=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusMovedPermanently || loc != "docs/?v=1" {
+		t.Fatalf("GET /ui/docs = %d %q; want 301 \"docs/?v=1\"", resp.StatusCode, loc)
+	}
+
+	resp, err = client.Get(ts.URL + "/ui/docs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != "docs" {
+		t.Fatalf("GET /ui/docs/ = %d %q; want 200 \"docs\"", resp.StatusCode, b)
+	}
+}
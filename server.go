@@ -3,13 +3,25 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pires/go-proxyproto"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
 )
 
 /*
@@ -20,12 +32,83 @@ import (
 
 // Server structure; supports the zxdev/env package
 type Server struct {
-	Host     string `env:"H,require" default:"localhost" help:"localhost or FQDN"`
-	Mirror   bool   `default:"off" help:"http request policy [mirror|400]"`
-	CertPath string `default:"/var/certs"`
-	opt      *http.Server
+	Host        string `env:"H,require" default:"localhost" help:"localhost or FQDN[,FQDN...]"`
+	Mirror      bool   `default:"off" help:"http request policy [mirror|400]"`
+	Policy      string `help:"http request policy [mirror|reject|redirect]; overrides mirror"`
+	CertPath    string `default:"/var/certs"`
+	TLSAddr     string `help:"localhost/IP additional https listener; eg. :8443"`
+	CertFile    string `help:"TLSAddr certificate file"`
+	KeyFile     string `help:"TLSAddr key file"`
+	BindAddr    string `help:"FQDN listener local IP address; default all interfaces"`
+	H2C         bool   `default:"off" help:"localhost/IP cleartext HTTP/2 (h2c)"`
+	MaxConns    int    `help:"concurrent connection limit per listener; 0 unlimited"`
+	IdleTimeout int    `help:"keep-alive idle timeout seconds; 0 uses ReadTimeout"`
+	Proxy       bool   `default:"off" help:"PROXY protocol v1/v2 from a load balancer"`
+	ProxyFrom   string `help:"PROXY protocol trusted upstream CIDR list; eg. 10.0.0.0/8"`
+	MinTLS      string `help:"minimum TLS version [1.0|1.1|1.2|1.3]; default Go"`
+	Ciphers     string `help:"TLS 1.2 cipher suites; eg. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,..."`
+	NoTickets   bool   `default:"off" help:"disable TLS session ticket resumption"`
+	SelfSigned  bool   `default:"off" help:"localhost/IP https with a generated dev certificate"`
+
+	HostPolicy autocert.HostPolicy // overrides the Host autocert whitelist; eg. tenant lookup
+
+	opt     *http.Server
+	tls     *http.Server  // TLSAddr listener
+	http    *http.Server  // autocert :http listener
+	errLog  *log.Logger   // http.Server ErrorLog
+	ready   atomic.Bool   // readiness state
+	active  atomic.Int64  // in-flight requests
+	addr    atomic.Value  // primary listener address
+	drain   time.Duration // shutdown timeout; zero waits indefinitely
+	onDrain func()        // invoked once all connections drained
+	port    int           // New WithPort listener port
+	socket  string        // unix socket path removed on shutdown
+	logs    []*LogFile    // reopened on SIGHUP
 }
 
+// Logger sets the http.Server ErrorLog used for net/http internal errors
+// so they can be routed to an operator logging pipeline
+//
+//	srv.Logger(log.New(w, "server ", log.LstdFlags))
+func (srv *Server) Logger(l *log.Logger) *Server {
+	srv.errLog = l
+	if srv.opt != nil {
+		srv.opt.ErrorLog = l
+	}
+	return srv
+}
+
+// Drain sets the graceful shutdown timeout and an optional callback invoked
+// once all connections have drained; when the timeout expires first the
+// number of requests still in flight is logged {default:no timeout}
+//
+//	srv.Drain(time.Second*30, func() { log.Println("drained") })
+func (srv *Server) Drain(timeout time.Duration, fn func()) *Server {
+	srv.drain = timeout
+	srv.onDrain = fn
+	return srv
+}
+
+// Addr reports the address the primary listener is bound to, with the
+// port assigned by the system for a :0 host (eg. localhost:0 for tests);
+// empty until listening
+//
+//	go srv.Start(ctx)
+//	http.Get("http://" + srv.Addr() + "/hb")
+func (srv *Server) Addr() string {
+	addr, _ := srv.addr.Load().(string)
+	return addr
+}
+
+// InFlight reports the number of requests currently being served
+func (srv *Server) InFlight() int64 { return srv.active.Load() }
+
+// SetReady sets the readiness state reported by Ready; {default:false}
+func (srv *Server) SetReady(ready bool) { srv.ready.Store(ready) }
+
+// Ready reports the readiness state; suitable for server.WithReadyz
+func (srv *Server) Ready() bool { return srv.ready.Load() }
+
 // Configure is a *Server configurator that takes *http.Server object and
 // applies defaults to opt when these reasonable defaults are not set; expects
 // the Handler to have been already set
@@ -55,8 +138,11 @@ func (srv *Server) Configure(opt *http.Server) *Server {
 		})
 	}
 
-	// configure log reporting
-	// srv.opt.ErrorLog = log.New(os.Stderr, "server ", log.LstdFlags)
+	// configure log reporting; net/http internals such as tls
+	// handshake errors go to the default logger unless set
+	if srv.opt.ErrorLog == nil {
+		srv.opt.ErrorLog = srv.errLog
+	}
 
 	return srv
 }
@@ -65,6 +151,51 @@ func (srv *Server) Configure(opt *http.Server) *Server {
 // defined by *Server.Redirect
 func (srv *Server) Start(ctx context.Context) {
 
+	if err := srv.open(); err != nil {
+		log.Println("alert:", err)
+	}
+	srv.hangup(ctx)
+
+	<-ctx.Done()   // wait for a shutdown signal
+	srv.shutdown() // gracefully shutdown
+	log.Println("server: shutdown")
+
+}
+
+// Run configures srv with handler and sane defaults when it was not
+// configured, starts listening, and blocks until ctx is cancelled then
+// shuts down gracefully; for use without a graceful manager and unlike
+// Start a listener that fails to start is returned as an error
+//
+//	if err := srv.Run(ctx, router); err != nil {
+//		log.Fatal(err)
+//	}
+func (srv *Server) Run(ctx context.Context, handler http.Handler) error {
+
+	switch {
+	case srv.opt == nil:
+		srv.Configure(&http.Server{Handler: handler, ReadHeaderTimeout: time.Second * 5})
+	case handler != nil:
+		srv.opt.Handler = handler
+	}
+
+	if err := srv.open(); err != nil {
+		srv.shutdown()
+		return err
+	}
+	srv.hangup(ctx)
+
+	<-ctx.Done()
+	err := srv.shutdown()
+	log.Println("server: shutdown")
+	return err
+
+}
+
+// open the listeners and serve them; the error reports each listener that
+// failed while the others keep serving
+func (srv *Server) open() error {
+
 	if srv.opt == nil {
 		log.Println("alert: server was not configured")
 		srv.Configure(nil)
@@ -74,14 +205,75 @@ func (srv *Server) Start(ctx context.Context) {
 		srv.Host = "localhost"
 	}
 
-	// localhost or an IP address; required to have a fqdn to not use http protocol
-	if strings.HasPrefix(srv.Host, "localhost") || net.ParseIP(srv.Host) != nil {
+	if err := srv.Validate(); err != nil {
+		log.Println("alert:", err)
+	}
+
+	srv.instrument()
+
+	// unix domain socket; a local reverse proxy sidecar reaches the server
+	// without exposing a port so tls and autocert do not apply
+	if socket, ok := strings.CutPrefix(srv.Host, "unix:"); ok {
 
-		if !strings.Contains(srv.Host, ":") {
-			srv.Host += ":1455" // apply default port
+		if err := staleSocket(socket); err != nil {
+			return err
+		}
+		ln, err := srv.listen("unix", socket)
+		if err != nil {
+			return err
+		}
+		srv.socket = socket // removed on shutdown
+		srv.addr.Store(ln.Addr().String())
+		go srv.opt.Serve(ln)
+
+	} else if isLocal(srv.Host) {
+		// localhost or an IP address; required to have a fqdn to not use http protocol
+
+		// the IP portion binds that local address; eg. 10.0.0.5:1455
+		if _, _, err := net.SplitHostPort(srv.Host); err != nil {
+			srv.Host = net.JoinHostPort(srv.Host, "1455") // apply default port
 		}
 		srv.opt.Addr = srv.Host
-		go srv.opt.ListenAndServe()
+
+		// cleartext HTTP/2 for internal traffic; the TLS listeners
+		// negotiate h2 with ALPN so only this listener is wrapped
+		var errs []error
+		h := srv.opt.Handler
+		switch {
+		case srv.SelfSigned:
+			// https on a laptop without a FQDN; h2 is negotiated with ALPN
+			cert, err := selfSigned(srv.Host)
+			if err != nil {
+				return err
+			}
+			srv.opt.TLSConfig = srv.tlsConfig(&tls.Config{Certificates: []tls.Certificate{cert}})
+			errs = append(errs, srv.serve(srv.opt, true))
+			log.Println("server: self-signed https")
+		case srv.H2C:
+			srv.opt.Handler = h2c.NewHandler(h, &http2.Server{IdleTimeout: srv.opt.IdleTimeout})
+			log.Println("server: h2c enabled")
+			fallthrough
+		default:
+			errs = append(errs, srv.serve(srv.opt, false))
+		}
+
+		// an optional https listener alongside the http listener for
+		// split internal/external topologies on a single process
+		if len(srv.TLSAddr) > 0 {
+			if len(srv.CertFile) == 0 || len(srv.KeyFile) == 0 {
+				errs = append(errs, errors.New("server: TLSAddr requires CertFile and KeyFile"))
+			} else {
+				srv.tls = srv.clone(srv.TLSAddr)
+				srv.tls.Handler = h
+				srv.tls.TLSConfig = srv.tlsConfig(nil)
+				errs = append(errs, srv.serve(srv.tls, true))
+				log.Printf("server: https %s", srv.TLSAddr)
+			}
+		}
+
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
 
 	} else {
 
@@ -89,44 +281,443 @@ func (srv *Server) Start(ctx context.Context) {
 		// requires port 80 for issuance and renewals, however we can configure a http traffic
 		// policy that autocert.Mangager can use for all other http traffic requests since
 
+		policy := autocert.HostWhitelist(srv.hosts()...) // whitelist our FQDNs here
+		if srv.HostPolicy != nil {
+			policy = srv.HostPolicy
+		}
+
+		if err := certCache(srv.CertPath); err != nil {
+			log.Printf("alert: server: CertPath %v; certificates are not cached and are reissued on restart", err)
+		}
+
 		mgr := autocert.Manager{
-			Prompt:     autocert.AcceptTOS,               // auto accpet TOS
-			HostPolicy: autocert.HostWhitelist(srv.Host), // whitelist our FQDN here
-			Cache:      autocert.DirCache(srv.CertPath),  // certs directory
+			Prompt:     autocert.AcceptTOS,              // auto accpet TOS
+			HostPolicy: policy,                          // permitted FQDNs
+			Cache:      autocert.DirCache(srv.CertPath), // certs directory
 		}
-		srv.opt.TLSConfig = &tls.Config{GetCertificate: mgr.GetCertificate}
-		srv.opt.Addr = ":https"
+		srv.opt.TLSConfig = srv.tlsConfig(&tls.Config{GetCertificate: mgr.GetCertificate})
+		srv.opt.Addr = net.JoinHostPort(srv.BindAddr, "https")
 
 		// a basic redirect policy is enabled by passing mgr.HTTPHandler(nil) and that will
 		// return 302 <a href="https://dev.netstar.one/{path}">Found</a>. for GET/HEAD and 400
 		// for all other requests, which is not helpful in an API based use case. So we specify
-		// and limit our choices to an http traffic mirror or a 400 bad-request response since
+		// and limit our choices to an http traffic mirror, a 400 bad-request response, or a
+		// 308 permanent redirect that preserves the method and body for all requests since
 		// we do not want the default 302 redirect responses
 
-		if srv.Mirror {
+		var fallback http.Handler
+		switch srv.policy() {
+		case "mirror":
 
 			log.Println("server: http traffic mirror")
-			go http.ListenAndServe(":http", mgr.HTTPHandler(srv.opt.Handler))
+			fallback = srv.opt.Handler
+
+		case "redirect":
+
+			log.Println("server: http traffic redirect")
+			fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+			})
 
-		} else {
+		default:
 
 			log.Println("server: http traffic bad-request")
-			go http.ListenAndServe(":http", mgr.HTTPHandler(
-				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusBadRequest)
-				})))
+			fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			})
 
 		}
 
+		srv.http = srv.clone(net.JoinHostPort(srv.BindAddr, "http"))
+		srv.http.Handler = mgr.HTTPHandler(fallback)
+		srv.http.TLSConfig = nil
+
 		// the Key/Cert are coming from Let's Encrypt; pass empty values
-		go srv.opt.ListenAndServeTLS("", "")
+		if err := errors.Join(srv.serve(srv.http, false), srv.serve(srv.opt, true)); err != nil {
+			return err
+		}
 
 	}
 
 	log.Printf("server: %s", srv.Host)
+	return nil
 
-	<-ctx.Done()                           // wait for a shutdown signal
-	srv.opt.Shutdown(context.Background()) // gracefully shutdown
-	log.Println("server: shutdown")
+}
+
+// shutdown all listeners together within the drain timeout and report
+// the requests that were still in flight when the timeout expired
+func (srv *Server) shutdown() error {
+
+	if len(srv.socket) > 0 {
+		defer os.Remove(srv.socket)
+	}
+
+	ctx := context.Background()
+	if srv.drain > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.drain)
+		defer cancel()
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i, s := range []*http.Server{srv.opt, srv.tls, srv.http} {
+		if s != nil {
+			wg.Add(1)
+			go func(i int, s *http.Server) {
+				defer wg.Done()
+				errs[i] = s.Shutdown(ctx)
+			}(i, s)
+		}
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("server: shutdown %v; %d requests in flight", err, srv.active.Load())
+		return err
+	}
+
+	if srv.onDrain != nil {
+		srv.onDrain()
+	}
+	return nil
+}
+
+// instrument applies the IdleTimeout and counts in-flight requests for
+// the shutdown drain report
+func (srv *Server) instrument() {
+
+	if srv.IdleTimeout > 0 {
+		srv.opt.IdleTimeout = time.Duration(srv.IdleTimeout) * time.Second
+	}
+
+	next := srv.opt.Handler
+	srv.opt.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.active.Add(1)
+		defer srv.active.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listen on addr with the MaxConns limit applied; with Proxy the PROXY
+// protocol header sets the client address seen as r.RemoteAddr
+func (srv *Server) listen(network, addr string) (net.Listener, error) {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if srv.MaxConns > 0 {
+		ln = netutil.LimitListener(ln, srv.MaxConns)
+	}
+	if srv.Proxy {
+		ln = &proxyproto.Listener{Listener: ln, Policy: srv.proxyPolicy()}
+	}
+	return ln, nil
+}
+
+// proxyPolicy requires the PROXY protocol header from the ProxyFrom
+// upstreams and rejects a connection from anywhere else that sends one,
+// since a client that could set its own header would spoof r.RemoteAddr
+// for RealIP, Lockout, and the auth allowlists; no ProxyFrom trusts none
+func (srv *Server) proxyPolicy() proxyproto.PolicyFunc {
+	trusted, _ := prefixes(srv.ProxyFrom)
+	return func(upstream net.Addr) (proxyproto.Policy, error) {
+		if peer, err := netip.ParseAddrPort(upstream.String()); err == nil {
+			for i := range trusted {
+				if trusted[i].Contains(peer.Addr().Unmap()) {
+					return proxyproto.REQUIRE, nil
+				}
+			}
+		}
+		return proxyproto.REJECT, nil
+	}
+}
+
+// prefixes parses a comma separated CIDR list where a bare IP is a
+// single address
+func prefixes(list string) (trusted []netip.Prefix, err error) {
+	for _, c := range strings.Split(list, ",") {
+		if c = strings.TrimSpace(c); len(c) == 0 {
+			continue
+		}
+		var p netip.Prefix
+		if addr, aerr := netip.ParseAddr(c); aerr == nil {
+			p = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		} else if p, err = netip.ParsePrefix(c); err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, p.Masked())
+	}
+	return
+}
+
+// serve s on its Addr; tls uses CertFile/KeyFile for the TLSAddr listener
+// otherwise the autocert or self-signed certificate of s.TLSConfig
+func (srv *Server) serve(s *http.Server, tls bool) error {
+	ln, err := srv.listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if s == srv.opt {
+		srv.addr.Store(ln.Addr().String())
+	}
+	switch {
+	case !tls:
+		go s.Serve(ln)
+	case s == srv.tls:
+		go s.ServeTLS(ln, srv.CertFile, srv.KeyFile)
+	default:
+		go s.ServeTLS(ln, "", "")
+	}
+	return nil
+}
+
+// tlsConfig applies the MinTLS version, Ciphers suites, and NoTickets to
+// c; a nil c starts from an empty tls.Config
+//
+// session tickets stay enabled by default and crypto/tls rotates the ticket
+// keys itself every 24h so there is no key material to manage; NoTickets
+// trades the resumption round trip for forward secrecy of each session
+//
+// OCSP responses are not stapled as autocert does not fetch them and Let's
+// Encrypt no longer runs an OCSP responder; revocation is left to the
+// short certificate lifetime
+func (srv *Server) tlsConfig(c *tls.Config) *tls.Config {
+	if c == nil {
+		c = new(tls.Config)
+	}
+	c.SessionTicketsDisabled = srv.NoTickets
+	if v, err := tlsVersion(srv.MinTLS); err == nil {
+		c.MinVersion = v
+	}
+	if list, err := cipherSuites(srv.Ciphers); err == nil {
+		c.CipherSuites = list
+	}
+	return c
+}
+
+// tlsVersion parses a MinTLS version; empty is the Go default
+func tlsVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "tls") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", v)
+}
+
+// cipherSuites parses a comma separated Ciphers list of secure cipher
+// suite names; empty is the Go default and TLS 1.3 suites are fixed
+func cipherSuites(names string) (list []uint16, err error) {
+	known := make(map[string]uint16)
+	for _, c := range tls.CipherSuites() {
+		known[c.Name] = c.ID
+	}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		list = append(list, id)
+	}
+	return list, nil
+}
+
+// h2Cipher reports when list has a cipher suite HTTP/2 requires of TLS 1.2
+func h2Cipher(list []uint16) bool {
+	for _, id := range list {
+		if id == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || id == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			return true
+		}
+	}
+	return false
+}
+
+// certCache creates the autocert cache directory when missing and checks
+// that it is writable since autocert.DirCache only fails on first issuance
+func certCache(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// staleSocket removes a socket left by an unclean exit; any other file at
+// path is an error so a mistyped path never deletes a regular file
+func staleSocket(path string) error {
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case info.Mode()&fs.ModeSocket == 0:
+		return fmt.Errorf("server: unix socket %q exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
+
+// hosts splits a comma separated Host into the FQDN list
+func (srv *Server) hosts() (list []string) {
+	for _, h := range strings.Split(srv.Host, ",") {
+		if h = strings.TrimSpace(h); len(h) > 0 {
+			list = append(list, h)
+		}
+	}
+	return
+}
+
+// policy resolves the http traffic policy; Policy overrides Mirror
+func (srv *Server) policy() string {
+	switch strings.ToLower(srv.Policy) {
+	case "mirror", "redirect":
+		return strings.ToLower(srv.Policy)
+	case "reject", "400":
+		return "reject"
+	}
+	if srv.Mirror {
+		return "mirror"
+	}
+	return "reject"
+}
+
+// clone the configured *http.Server settings for an additional listener
+func (srv *Server) clone(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           srv.opt.Handler,
+		TLSConfig:         srv.opt.TLSConfig,
+		ReadTimeout:       srv.opt.ReadTimeout,
+		ReadHeaderTimeout: srv.opt.ReadHeaderTimeout,
+		WriteTimeout:      srv.opt.WriteTimeout,
+		IdleTimeout:       srv.opt.IdleTimeout,
+		MaxHeaderBytes:    srv.opt.MaxHeaderBytes,
+		ErrorLog:          srv.opt.ErrorLog,
+	}
+}
+
+// isLocal reports when host is localhost or an IP address with an optional port
+func isLocal(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.HasPrefix(host, "localhost") || net.ParseIP(host) != nil
+}
+
+// validPort checks that an address has a parseable port when one is present
+func validPort(addr string) error {
+	if !strings.Contains(addr, ":") || net.ParseIP(addr) != nil {
+		return nil // no port; a bare IPv6 address has colons
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if _, err = net.LookupPort("tcp", port); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate the *Server configuration without binding any ports so that a
+// misconfiguration is caught in a pre-flight check rather than at runtime;
+// all problems are reported together
+func (srv *Server) Validate() error {
+
+	var errs []error
+	host := srv.Host
+	if len(host) == 0 {
+		host = "localhost"
+	}
+
+	if socket, ok := strings.CutPrefix(host, "unix:"); ok {
+		if info, err := os.Stat(filepath.Dir(socket)); err != nil || !info.IsDir() || len(socket) == 0 {
+			errs = append(errs, fmt.Errorf("server: unix socket %q directory is missing", socket))
+		}
+	} else if isLocal(host) {
+		if err := validPort(host); err != nil {
+			errs = append(errs, fmt.Errorf("server: host %q: %w", host, err))
+		}
+	} else {
+		for _, host := range srv.hosts() {
+			if strings.Contains(host, ":") || strings.ContainsAny(host, " /") || !strings.Contains(host, ".") {
+				errs = append(errs, fmt.Errorf("server: host %q is not a FQDN", host))
+			}
+		}
+		if len(srv.CertPath) == 0 {
+			errs = append(errs, errors.New("server: CertPath is required for a FQDN"))
+		}
+	}
+
+	if len(srv.TLSAddr) > 0 {
+		if err := validPort(srv.TLSAddr); err != nil {
+			errs = append(errs, fmt.Errorf("server: TLSAddr %q: %w", srv.TLSAddr, err))
+		}
+		if _, err := tls.LoadX509KeyPair(srv.CertFile, srv.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("server: TLSAddr certificate: %w", err))
+		}
+	}
+
+	if srv.SelfSigned && !isLocal(host) {
+		errs = append(errs, errors.New("server: SelfSigned requires a localhost or IP host"))
+	}
+
+	if srv.MaxConns < 0 || srv.IdleTimeout < 0 {
+		errs = append(errs, errors.New("server: MaxConns and IdleTimeout can not be negative"))
+	}
+
+	version, err := tlsVersion(srv.MinTLS)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("server: MinTLS: %w", err))
+	}
+	if list, err := cipherSuites(srv.Ciphers); err != nil {
+		errs = append(errs, fmt.Errorf("server: Ciphers: %w", err))
+	} else if len(list) > 0 && version != tls.VersionTLS13 && !h2Cipher(list) {
+		errs = append(errs, errors.New("server: Ciphers requires an ECDHE AES_128_GCM_SHA256 suite for HTTP/2"))
+	}
+
+	if list, err := prefixes(srv.ProxyFrom); err != nil {
+		errs = append(errs, fmt.Errorf("server: ProxyFrom: %w", err))
+	} else if srv.Proxy && len(list) == 0 {
+		errs = append(errs, errors.New("server: Proxy requires ProxyFrom trusted upstreams"))
+	}
+
+	if len(srv.BindAddr) > 0 && net.ParseIP(srv.BindAddr) == nil {
+		errs = append(errs, fmt.Errorf("server: BindAddr %q is not an IP address", srv.BindAddr))
+	}
+
+	switch strings.ToLower(srv.Policy) {
+	case "", "mirror", "reject", "400", "redirect":
+	default:
+		errs = append(errs, fmt.Errorf("server: unknown Policy %q", srv.Policy))
+	}
+
+	if srv.opt != nil {
+		if srv.opt.ReadTimeout < 0 {
+			errs = append(errs, errors.New("server: ReadTimeout is negative"))
+		}
+		if srv.opt.ReadTimeout > 0 && srv.opt.ReadHeaderTimeout > srv.opt.ReadTimeout {
+			errs = append(errs, errors.New("server: ReadHeaderTimeout exceeds ReadTimeout"))
+		}
+		if srv.opt.WriteTimeout > 0 && srv.opt.WriteTimeout < srv.opt.ReadHeaderTimeout {
+			errs = append(errs, errors.New("server: WriteTimeout is shorter than ReadHeaderTimeout"))
+		}
+	}
 
+	return errors.Join(errs...)
 }
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMinTLSRejectsOlderClients(t *testing.T) {
+
+	for _, tc := range []struct {
+		minTLS string
+		client uint16 // client MaxVersion
+		ok     bool
+	}{
+		{"1.2", tls.VersionTLS11, false},
+		{"1.2", tls.VersionTLS12, true},
+		{"1.3", tls.VersionTLS12, false},
+		{"1.3", tls.VersionTLS13, true},
+	} {
+		srv := &Server{MinTLS: tc.minTLS}
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.TLS = srv.tlsConfig(nil)
+		ts.StartTLS()
+
+		conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS10,
+			MaxVersion:         tc.client,
+		})
+		if err == nil {
+			conn.Close()
+		}
+		if (err == nil) != tc.ok {
+			t.Errorf("MinTLS %s client max %#x: err = %v; want ok %v", tc.minTLS, tc.client, err, tc.ok)
+		}
+		ts.Close()
+	}
+}
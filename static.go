@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// static is a fs.FS mounted under a route prefix
+type static struct {
+	prefix string
+	fsys   fs.FS
+	spa    bool // index.html fallback
+}
+
+// WithStatic mounts fsys (eg. an embed.FS) under the route prefix; it
+// coexists with the dlPath and docPath routes
+//
+//	//go:embed ui
+//	var ui embed.FS
+//	sub, _ := fs.Sub(ui, "ui")
+//	router := server.Public(server.Heartbeat, nil, nil, server.WithStatic("/ui", sub))
+func WithStatic(prefix string, fsys fs.FS) RouteOption {
+	return func(rt *routes) { rt.static = append(rt.static, static{prefix, fsys, false}) }
+}
+
+// WithSPA mounts a single-page app fsys under the route prefix where
+// unknown non-asset paths serve index.html for client side routing; use
+// os.DirFS for a static root on disk
+//
+//	router := server.Public(server.Heartbeat, nil, nil, server.WithSPA("/", os.DirFS("/srv/app")))
+func WithSPA(prefix string, fsys fs.FS) RouteOption {
+	return func(rt *routes) { rt.static = append(rt.static, static{prefix, fsys, true}) }
+}
+
+// Mount a http.Handler serving fsys under prefix on a chi.Router
+func Mount(router chi.Router, prefix string, fsys fs.FS) {
+	mount(router, prefix, Static(fsys))
+}
+
+// mount h under prefix with the prefix stripped from the request path
+func mount(router chi.Router, prefix string, h http.Handler) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" { // replaces the Public root route
+		router.Handle("/", h)
+		router.Handle("/*", h)
+		return
+	}
+	router.Handle(prefix, http.RedirectHandler(prefix+"/", http.StatusMovedPermanently))
+	router.Handle(prefix+"/*", http.StripPrefix(prefix, h))
+}
+
+// Static returns a http.Handler that serves files from fsys with content
+// types by extension, index.html for directories, and If-Modified-Since
+// support; files without a modtime (embed.FS) use the process start time
+func Static(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !serveFS(w, r, fsys, strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")) {
+			w.WriteHeader(http.StatusNotFound) // 404
+		}
+	})
+}
+
+// SPA returns a http.Handler like Static that serves index.html for
+// missing paths without an extension while missing assets such as
+// .js or .css still return a real 404
+func SPA(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if serveFS(w, r, fsys, name) {
+			return
+		}
+		if ext := path.Ext(name); (len(ext) == 0 || ext == ".html") && serveFS(w, r, fsys, "index.html") {
+			return
+		}
+		w.WriteHeader(http.StatusNotFound) // 404
+	})
+}
+
+// serveFS serves name from fsys and reports false when there is no file
+func serveFS(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) bool {
+
+	if len(name) == 0 {
+		name = "."
+	}
+
+	info, err := fs.Stat(fsys, name)
+	if err == nil && info.IsDir() {
+		// relative links in the index resolve against the directory only
+		// with the trailing slash; redirect as http.FileServer does
+		if name != "." && !strings.HasSuffix(r.URL.Path, "/") {
+			target := path.Base(r.URL.Path) + "/"
+			if len(r.URL.RawQuery) > 0 {
+				target += "?" + r.URL.RawQuery
+			}
+			// relative Location; http.Redirect would resolve it against
+			// the path without the mount prefix
+			w.Header().Set("Location", target)
+			w.WriteHeader(http.StatusMovedPermanently) // 301
+			return true
+		}
+		name = path.Join(name, "index.html")
+		info, err = fs.Stat(fsys, name)
+	}
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	modtime := info.ModTime()
+	if modtime.IsZero() {
+		modtime = started.Truncate(time.Second)
+	}
+
+	// embed.FS files are seekable; read any other fs.File into memory
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return false
+		}
+		rs = bytes.NewReader(b)
+	}
+
+	http.ServeContent(w, r, info.Name(), modtime, rs)
+	return true
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// TestServer starts an in-process httptest.Server on a loopback port with
+// the handler and the same *http.Server defaults and options as New so
+// protected routes can be table tested with the production configuration
+//
+//	ts, cleanup := server.TestServer(router, server.WithReadTimeout(time.Second))
+//	defer cleanup()
+//	req, _ := http.NewRequest("GET", ts.URL+"/private", nil)
+//	req.Header.Set("token", key)
+//	resp, err := ts.Client().Do(req)
+func TestServer(handler http.Handler, opts ...Option) (*httptest.Server, func()) {
+
+	srv := New(append(opts, WithHandler(handler))...)
+	srv.instrument()
+
+	ts := httptest.NewUnstartedServer(srv.opt.Handler)
+	ts.Config = srv.opt
+	ts.Start()
+
+	return ts, ts.Close
+}